@@ -0,0 +1,276 @@
+// Package agent pushes what a remote machine collects to a central Minator
+// server, buffering it while the server can't be reached.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"minator/data"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxBuffered is about 3.5 days of collections every 30s.
+	DefaultMaxBuffered = 10000
+	// maxBatch stays well below the server's limit of items per report.
+	maxBatch    = 100
+	sendTimeout = 30 * time.Second
+)
+
+// Client implements monitor.Sink by sending reports to the server. Whatever
+// can't be sent is kept, up to MaxBuffered entries, and sent along with the
+// next report. With a BufferFile, the pending entries survive restarts.
+type Client struct {
+	Server      string
+	Token       string
+	Host        string
+	BufferFile  string
+	MaxBuffered int
+	HTTPClient  *http.Client
+
+	mu      sync.Mutex
+	pending pending
+}
+
+// pending is what hasn't been accepted by the server yet, oldest first.
+type pending struct {
+	Statuses []data.ServiceStatus   `json:"statuses"`
+	Metrics  []data.HardwareMetrics `json:"metrics"`
+}
+
+func (p *pending) len() int {
+	return len(p.Statuses) + len(p.Metrics)
+}
+
+func NewClient(server, token, host string) *Client {
+	return &Client{
+		Server:      strings.TrimSuffix(server, "/"),
+		Token:       token,
+		Host:        host,
+		MaxBuffered: DefaultMaxBuffered,
+		HTTPClient:  &http.Client{Timeout: sendTimeout},
+	}
+}
+
+// LoadBuffer restores entries left over by a previous run from BufferFile.
+func (c *Client) LoadBuffer() error {
+	if c.BufferFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(c.BufferFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := json.Unmarshal(b, &c.pending); err != nil {
+		return fmt.Errorf("failed to parse buffer file %s: %v", c.BufferFile, err)
+	}
+	slog.Info("Loaded buffered reports", "count", c.pending.len())
+	return nil
+}
+
+func (c *Client) WriteStatuses(ctx context.Context, statuses []data.ServiceStatus) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending.Statuses = append(c.pending.Statuses, statuses...)
+	return c.flush(ctx)
+}
+
+func (c *Client) WriteMetrics(ctx context.Context, metrics data.HardwareMetrics) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending.Metrics = append(c.pending.Metrics, metrics)
+	return c.flush(ctx)
+}
+
+// flush sends pending entries in batches until they are all sent or the
+// server fails, in which case they are kept (and saved) for the next time.
+// Statuses and metrics go in separate reports, so statuses the server
+// rejects never hold back the metrics.
+func (c *Client) flush(ctx context.Context) error {
+	// The monitor's context is meant for a single database write, sending a
+	// backlog needs longer.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
+	err := c.flushStatuses(ctx)
+	if err == nil {
+		err = c.flushMetrics(ctx)
+	}
+	c.trim()
+	c.save()
+	return err
+}
+
+func (c *Client) flushStatuses(ctx context.Context) error {
+	for len(c.pending.Statuses) > 0 {
+		batch := c.pending.Statuses[:min(len(c.pending.Statuses), maxBatch)]
+		err := c.send(ctx, data.AgentReport{Host: c.Host, Statuses: batch})
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			// Resend the rest of the batch without the statuses at fault,
+			// unless the whole report was.
+			if bad := rejected.statuses(len(batch)); len(bad) > 0 && len(bad) < len(batch) {
+				var keep []data.ServiceStatus
+				for i, s := range batch {
+					if bad[i] {
+						slog.Error("Server rejected status, dropping it", "name", s.Name, "status", rejected.code, "reason", rejected.reason(i))
+						continue
+					}
+					keep = append(keep, s)
+				}
+				c.pending.Statuses = append(keep, c.pending.Statuses[len(batch):]...)
+				continue
+			}
+			slog.Error("Server rejected statuses, dropping them", "count", len(batch), "status", rejected.code, "response", rejected.msg)
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		c.pending.Statuses = c.pending.Statuses[len(batch):]
+	}
+	return nil
+}
+
+func (c *Client) flushMetrics(ctx context.Context) error {
+	for len(c.pending.Metrics) > 0 {
+		batch := c.pending.Metrics[:min(len(c.pending.Metrics), maxBatch)]
+		err := c.send(ctx, data.AgentReport{Host: c.Host, Metrics: batch})
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			slog.Error("Server rejected metrics, dropping them", "count", len(batch), "status", rejected.code, "response", rejected.msg)
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		c.pending.Metrics = c.pending.Metrics[len(batch):]
+	}
+	return nil
+}
+
+// trim drops the oldest entries beyond MaxBuffered.
+func (c *Client) trim() {
+	over := c.pending.len() - c.MaxBuffered
+	if over <= 0 {
+		return
+	}
+	slog.Warn("Agent buffer is full, dropping oldest entries", "dropped", over)
+	// Metrics are far more numerous than statuses, drop those first.
+	n := min(over, len(c.pending.Metrics))
+	c.pending.Metrics = c.pending.Metrics[n:]
+	c.pending.Statuses = c.pending.Statuses[over-n:]
+}
+
+func (c *Client) save() {
+	if c.BufferFile == "" {
+		return
+	}
+	if c.pending.len() == 0 {
+		if err := os.Remove(c.BufferFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to remove buffer file", "file", c.BufferFile, "error", err)
+		}
+		return
+	}
+	b, err := json.Marshal(c.pending)
+	if err == nil {
+		// Write then rename so a crash never leaves half a file behind.
+		tmp := c.BufferFile + ".tmp"
+		if err = os.WriteFile(tmp, b, 0o600); err == nil {
+			err = os.Rename(tmp, c.BufferFile)
+		}
+	}
+	if err != nil {
+		slog.Warn("Failed to save buffer file", "file", c.BufferFile, "error", err)
+	}
+}
+
+// rejectedError is a report the server will never accept as is.
+type rejectedError struct {
+	code   int
+	msg    string
+	fields map[string]string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("server rejected report with %d: %s", e.code, e.msg)
+}
+
+// statuses returns the indexes of the statuses the server pointed at, or
+// nil when it pointed at anything else, such as the host or the metrics.
+func (e *rejectedError) statuses(n int) map[int]bool {
+	bad := map[int]bool{}
+	for field := range e.fields {
+		var i int
+		if _, err := fmt.Sscanf(field, "statuses[%d]", &i); err != nil || i < 0 || i >= n {
+			return nil
+		}
+		bad[i] = true
+	}
+	return bad
+}
+
+// reason returns what the server found wrong with status i.
+func (e *rejectedError) reason(i int) string {
+	prefix := fmt.Sprintf("statuses[%d]", i)
+	var reasons []string
+	for field, msg := range e.fields {
+		if strings.HasPrefix(field, prefix) {
+			reasons = append(reasons, strings.TrimPrefix(field, prefix+".")+": "+msg)
+		}
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, ", ")
+}
+
+// send posts report to the server. Reports the server will never accept,
+// because they are invalid, clash with another host's service names or
+// the token doesn't allow them, come back as a *rejectedError.
+func (c *Client) send(ctx context.Context, report data.AgentReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Server+"/api/agent/report", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("server unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusConflict,
+		http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		var e struct {
+			Error  string            `json:"error"`
+			Fields map[string]string `json:"fields"`
+		}
+		if json.Unmarshal(msg, &e) != nil || e.Error == "" {
+			e.Error = string(msg)
+		}
+		return &rejectedError{code: resp.StatusCode, msg: e.Error, fields: e.Fields}
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server answered %s: %s", resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"minator/data"
+	"minator/hub"
+	"minator/repository"
+	"slices"
+	"time"
+)
+
+const (
+	notifyTimeout = 30 * time.Second
+	// escalateEvery is how often firing alerts are checked for a due
+	// escalation step or repeat.
+	escalateEvery = 30 * time.Second
+	dbTimeout     = 5 * time.Second
+)
+
+// ErrNotFiring is returned when acknowledging an alert that is resolved,
+// already acknowledged or unknown.
+var ErrNotFiring = errors.New("alert is not firing")
+
+// Notifier delivers alerts to people, e.g. by email.
+type Notifier interface {
+	Notify(ctx context.Context, a data.Alert) error
+}
+
+// Silencer tells whether alerts for a service are suppressed at t, e.g.
+// during maintenance.
+type Silencer interface {
+	Silenced(name string, t time.Time) bool
+}
+
+// Manager follows published statuses and raises an alert when a service
+// goes down, resolving it once the service recovers. Alerts are published
+// to the alert hub and handed to the channels of the matching policy,
+// escalating until they are acknowledged. Their state is kept in the
+// database so a restart picks up where it left off.
+type Manager struct {
+	// Silencer, if set, keeps silenced services from raising alerts. An
+	// alert already firing stops escalating but is still resolved.
+	Silencer Silencer
+	// Policies decide who is notified and when, the first one matching a
+	// service applies. Without any, every channel is notified right away.
+	Policies []Policy
+
+	repo      repository.AlertRepo
+	statusHub *hub.Hub[[]data.ServiceStatus]
+	alertHub  *hub.Hub[data.Alert]
+	channels  map[string]Notifier
+
+	// firing is only touched by the goroutine running Run, acknowledgements
+	// are handed to it through acks.
+	firing map[string]*data.Alert
+	queue  chan notification
+	acks   chan ackRequest
+}
+
+// notification is an alert to deliver to the named channels.
+type notification struct {
+	alert    data.Alert
+	channels []string
+}
+
+type ackRequest struct {
+	id    int64
+	by    string
+	reply chan ackReply
+}
+
+type ackReply struct {
+	alert data.Alert
+	err   error
+}
+
+// NewManager returns a manager notifying channels, keyed by the names
+// policies refer to them with.
+func NewManager(repo repository.AlertRepo, statusHub *hub.Hub[[]data.ServiceStatus], alertHub *hub.Hub[data.Alert], channels map[string]Notifier) *Manager {
+	return &Manager{
+		repo:      repo,
+		statusHub: statusHub,
+		alertHub:  alertHub,
+		channels:  channels,
+		firing:    make(map[string]*data.Alert),
+		queue:     make(chan notification, 100),
+		acks:      make(chan ackRequest),
+	}
+}
+
+func (m *Manager) Run(ctx context.Context) {
+	go m.notify(ctx)
+	m.restore()
+	ticker := time.NewTicker(escalateEvery)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		sub, _ := m.statusHub.Subscribe(0)
+		m.follow(ctx, sub, ticker.C)
+		sub.Close()
+	}
+	slog.Info("Stop alerting due to context cancellation.")
+}
+
+// restore loads the alerts that were firing when we stopped.
+func (m *Manager) restore() {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	open, err := m.repo.GetOpenAlerts(ctx)
+	if err != nil {
+		slog.Error("Failed to restore firing alerts", "error", err)
+		return
+	}
+	for _, a := range open {
+		m.firing[a.Name] = &a
+	}
+	if len(open) > 0 {
+		slog.Info("Restored firing alerts", "count", len(open))
+	}
+}
+
+// follow evaluates statuses until ctx is done or the hub drops us.
+func (m *Manager) follow(ctx context.Context, sub *hub.Subscription[[]data.ServiceStatus], tick <-chan time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				slog.Warn("Alert manager fell behind, resubscribing")
+				return
+			}
+			m.evaluate(e.Value)
+		case now := <-tick:
+			for _, a := range m.firing {
+				m.escalate(a, now)
+			}
+		case req := <-m.acks:
+			a, err := m.ack(req.id, req.by)
+			req.reply <- ackReply{a, err}
+		}
+	}
+}
+
+func (m *Manager) evaluate(statuses []data.ServiceStatus) {
+	for _, s := range statuses {
+		// Maintenance neither raises nor resolves alerts, whatever was
+		// going on before is picked up again once it is over.
+		if s.Status == data.StatusMaintenance {
+			continue
+		}
+		a, firing := m.firing[s.Name]
+		down := data.IsDown(s.Status)
+		switch {
+		case down && !firing:
+			// Only the root cause alerts, it names what it impacts.
+			if s.Status == data.StatusImpacted {
+				continue
+			}
+			if m.Silencer != nil && m.Silencer.Silenced(s.Name, s.Timestamp) {
+				slog.Debug("Alert silenced", "name", s.Name, "status", s.Status)
+				continue
+			}
+			m.fire(s)
+		case !down && firing:
+			delete(m.firing, s.Name)
+			m.resolve(a, s)
+		}
+	}
+}
+
+func (m *Manager) fire(s data.ServiceStatus) {
+	a := newAlert(s, "firing")
+	a.FiredAt = s.Timestamp
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	// Alerting goes on without the database, the alert just can't be
+	// acknowledged.
+	if err := m.repo.InsertAlert(ctx, &a); err != nil {
+		slog.Error("Failed to store alert", "name", a.Name, "error", err)
+	}
+	m.firing[s.Name] = &a
+	m.publish(a)
+	m.escalate(&a, time.Now())
+}
+
+// escalate notifies the steps of a that are due, or repeats the
+// notification when the policy asks for it. Both wait while the service is
+// silenced, steps that came due meanwhile go out once the silence ends.
+func (m *Manager) escalate(a *data.Alert, now time.Time) {
+	if a.AckedAt != nil {
+		return
+	}
+	if m.Silencer != nil && m.Silencer.Silenced(a.Name, now) {
+		return
+	}
+	p := m.policy(a.Name)
+	var channels []string
+	for a.Escalation < len(p.Steps) && !now.Before(a.FiredAt.Add(p.Steps[a.Escalation].After)) {
+		channels = append(channels, p.Steps[a.Escalation].Channels...)
+		a.Escalation++
+	}
+	repeat := len(channels) == 0 && a.Escalation == len(p.Steps) && p.Repeat > 0 &&
+		a.LastNotifiedAt != nil && !now.Before(a.LastNotifiedAt.Add(p.Repeat))
+	if repeat {
+		channels = p.reached(a.Escalation)
+	}
+	if len(channels) == 0 {
+		return
+	}
+	a.LastNotifiedAt = &now
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if err := m.repo.UpdateEscalation(ctx, *a); err != nil {
+		slog.Error("Failed to store alert escalation", "name", a.Name, "error", err)
+	}
+	n := *a
+	if n.Escalation > 1 || repeat {
+		n.Timestamp = now
+	}
+	m.enqueue(n, channels)
+}
+
+func (m *Manager) resolve(firing *data.Alert, s data.ServiceStatus) {
+	a := newAlert(s, "resolved")
+	a.ID, a.FiredAt, a.AckedAt, a.AckedBy = firing.ID, firing.FiredAt, firing.AckedAt, firing.AckedBy
+	a.Escalation, a.LastNotifiedAt = firing.Escalation, firing.LastNotifiedAt
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if err := m.repo.ResolveAlert(ctx, a); err != nil {
+		slog.Error("Failed to store resolved alert", "name", a.Name, "error", err)
+	}
+	m.publish(a)
+	// Whoever heard about the alert hears about its end.
+	p := m.policy(a.Name)
+	m.enqueue(a, p.reached(a.Escalation))
+}
+
+// Acknowledge stops the escalation of the firing alert id. It is still
+// resolved as usual once the service recovers.
+func (m *Manager) Acknowledge(ctx context.Context, id int64, by string) (data.Alert, error) {
+	req := ackRequest{id: id, by: by, reply: make(chan ackReply, 1)}
+	select {
+	case m.acks <- req:
+	case <-ctx.Done():
+		return data.Alert{}, ctx.Err()
+	}
+	select {
+	case r := <-req.reply:
+		return r.alert, r.err
+	case <-ctx.Done():
+		return data.Alert{}, ctx.Err()
+	}
+}
+
+func (m *Manager) ack(id int64, by string) (data.Alert, error) {
+	var a *data.Alert
+	for _, f := range m.firing {
+		if f.ID == id && id != 0 {
+			a = f
+		}
+	}
+	if a == nil || a.AckedAt != nil {
+		return data.Alert{}, ErrNotFiring
+	}
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if err := m.repo.AckAlert(ctx, id, by, now); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return data.Alert{}, ErrNotFiring
+		}
+		return data.Alert{}, err
+	}
+	a.AckedAt, a.AckedBy = &now, by
+	acked := *a
+	acked.State = "acknowledged"
+	acked.Timestamp = now
+	m.publish(acked)
+	m.enqueue(acked, m.policy(a.Name).reached(a.Escalation))
+	return acked, nil
+}
+
+// policy returns the policy applying to service name.
+func (m *Manager) policy(name string) Policy {
+	for _, p := range m.Policies {
+		if p.matches(name) {
+			return p
+		}
+	}
+	return Policy{Steps: []Step{{Channels: slices.Sorted(maps.Keys(m.channels))}}}
+}
+
+func newAlert(s data.ServiceStatus, state string) data.Alert {
+	return data.Alert{
+		Name:      s.Name,
+		State:     state,
+		Status:    s.Status,
+		Detail:    s.Detail,
+		Timestamp: s.Timestamp,
+	}
+}
+
+func (m *Manager) publish(a data.Alert) {
+	slog.Info("Alert", "name", a.Name, "state", a.State, "status", a.Status)
+	m.alertHub.Publish(a)
+}
+
+func (m *Manager) enqueue(a data.Alert, channels []string) {
+	if len(channels) == 0 {
+		return
+	}
+	select {
+	case m.queue <- notification{a, channels}:
+	default:
+		slog.Error("Alert notification queue is full, dropping", "name", a.Name, "state", a.State)
+	}
+}
+
+// notify delivers queued alerts one at a time so a slow notifier never
+// holds up status evaluation.
+func (m *Manager) notify(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-m.queue:
+			for _, name := range n.channels {
+				nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+				if err := m.channels[name].Notify(nctx, n.alert); err != nil {
+					slog.Error("Failed to send alert notification", "name", n.alert.Name, "channel", name, "error", err)
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+// LogNotifier writes alerts to the log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(_ context.Context, a data.Alert) error {
+	slog.Warn(Summary(a), "detail", a.Detail)
+	return nil
+}
+
+// Summary returns a one line description of a, e.g. for a mail subject.
+func Summary(a data.Alert) string {
+	switch {
+	case a.State == "resolved":
+		return fmt.Sprintf("[RESOLVED] %s is %s again", a.Name, a.Status)
+	case a.State == "acknowledged":
+		return fmt.Sprintf("[ACK] %s acknowledged by %s", a.Name, a.AckedBy)
+	case a.Timestamp.After(a.FiredAt):
+		return fmt.Sprintf("[FIRING] %s is still %s, since %s", a.Name, a.Status, a.FiredAt.Format(time.DateTime))
+	default:
+		return fmt.Sprintf("[FIRING] %s is %s", a.Name, a.Status)
+	}
+}
@@ -1 +1,71 @@
 package alert
+
+import (
+	"context"
+	"fmt"
+	"minator/data"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EmailNotifier sends alerts through an SMTP server.
+type EmailNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+// EmailNotifierFromEnv configures email alerting from MINATOR_SMTP_HOST,
+// MINATOR_SMTP_PORT (default 587), MINATOR_SMTP_USER, MINATOR_SMTP_PASSWORD,
+// MINATOR_ALERT_EMAIL_FROM and MINATOR_ALERT_EMAIL_TO (comma separated).
+// It returns false when host, sender or recipients are missing.
+func EmailNotifierFromEnv() (*EmailNotifier, bool) {
+	host := os.Getenv("MINATOR_SMTP_HOST")
+	from := os.Getenv("MINATOR_ALERT_EMAIL_FROM")
+	to := os.Getenv("MINATOR_ALERT_EMAIL_TO")
+	if host == "" || from == "" || to == "" {
+		return nil, false
+	}
+	port := os.Getenv("MINATOR_SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	var auth smtp.Auth
+	if user := os.Getenv("MINATOR_SMTP_USER"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("MINATOR_SMTP_PASSWORD"), host)
+	}
+	return &EmailNotifier{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+		to:   strings.Split(to, ","),
+	}, true
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, a data.Alert) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n\r\nStatus: %s\r\nDetail: %s\r\nTime: %s\r\n",
+		e.from, strings.Join(e.to, ", "), headerValue(Summary(a)), time.Now().Format(time.RFC1123Z),
+		Summary(a), a.Status, a.Detail, a.Timestamp.Format(time.RFC3339))
+	// net/smtp knows nothing about contexts, at least honour cancellation
+	// that happened before we got here.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(e.addr, e.auth, e.from, e.to, []byte(msg))
+}
+
+// headerValue replaces control characters, line breaks in particular, so a
+// service name can't add headers of its own to the mail.
+func headerValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,131 @@
+package alert
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"minator/data"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+// Policy decides who is notified about the alerts of Services (names or
+// patterns like "backup-*") and when. Each step notifies its channels once
+// the alert has been firing for After, unless it was acknowledged. Once
+// every step is done, Repeat (if set) notifies them all again every Repeat
+// until the alert is acknowledged or resolved.
+type Policy struct {
+	Services []string
+	Steps    []Step
+	Repeat   time.Duration
+}
+
+type Step struct {
+	After    time.Duration
+	Channels []string
+}
+
+// policyConfig is a Policy as written in MINATOR_ALERT_POLICY_FILE, e.g.
+//
+//	{"services": ["*"], "repeat": "1h", "steps": [
+//	  {"after": "0s", "channels": ["email"]},
+//	  {"after": "15m", "channels": ["webhook"]}]}
+type policyConfig struct {
+	Services []string `json:"services"`
+	Steps    []struct {
+		After    string   `json:"after"`
+		Channels []string `json:"channels"`
+	} `json:"steps"`
+	Repeat string `json:"repeat"`
+}
+
+// PoliciesFromEnv reads the policies from the JSON file in
+// MINATOR_ALERT_POLICY_FILE. Without it, every channel is notified right
+// away, once.
+func PoliciesFromEnv(channels map[string]Notifier) ([]Policy, error) {
+	file := os.Getenv("MINATOR_ALERT_POLICY_FILE")
+	if file == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert policy file: %v", err)
+	}
+	var configs []policyConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse alert policy file %s: %v", file, err)
+	}
+	policies := make([]Policy, 0, len(configs))
+	for i, c := range configs {
+		p, err := c.policy(channels)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d in %s: %v", i, file, err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func (c policyConfig) policy(channels map[string]Notifier) (Policy, error) {
+	p := Policy{Services: c.Services}
+	if len(p.Services) == 0 {
+		p.Services = []string{"*"}
+	}
+	for _, pattern := range p.Services {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return p, fmt.Errorf("invalid service pattern %q", pattern)
+		}
+	}
+	if len(c.Steps) == 0 {
+		return p, fmt.Errorf("at least one step is required")
+	}
+	for _, s := range c.Steps {
+		step := Step{Channels: s.Channels}
+		if s.After != "" {
+			d, err := data.ParseDuration(s.After)
+			if err != nil || d < 0 {
+				return p, fmt.Errorf("invalid after %q", s.After)
+			}
+			step.After = d
+		}
+		for _, name := range s.Channels {
+			if _, ok := channels[name]; !ok {
+				return p, fmt.Errorf("unknown or unconfigured channel %q", name)
+			}
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	slices.SortStableFunc(p.Steps, func(a, b Step) int { return cmp.Compare(a.After, b.After) })
+	if c.Repeat != "" {
+		d, err := data.ParseDuration(c.Repeat)
+		if err != nil || d < time.Minute {
+			return p, fmt.Errorf("repeat must be a duration of at least 1m")
+		}
+		p.Repeat = d
+	}
+	return p, nil
+}
+
+func (p Policy) matches(name string) bool {
+	for _, pattern := range p.Services {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// reached returns the channels of the first n steps.
+func (p Policy) reached(n int) []string {
+	var channels []string
+	for _, s := range p.Steps[:min(n, len(p.Steps))] {
+		for _, c := range s.Channels {
+			if !slices.Contains(channels, c) {
+				channels = append(channels, c)
+			}
+		}
+	}
+	return channels
+}
@@ -0,0 +1,55 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"minator/data"
+	"net/http"
+	"os"
+)
+
+// WebhookNotifier posts alerts as JSON, e.g. to a chat integration.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// WebhookNotifierFromEnv posts to MINATOR_ALERT_WEBHOOK_URL, it returns
+// false when it isn't set.
+func WebhookNotifierFromEnv() (*WebhookNotifier, bool) {
+	url := os.Getenv("MINATOR_ALERT_WEBHOOK_URL")
+	if url == "" {
+		return nil, false
+	}
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: notifyTimeout}}, true
+}
+
+type webhookPayload struct {
+	data.Alert
+	Summary string `json:"summary"`
+}
+
+func (wh *WebhookNotifier) Notify(ctx context.Context, a data.Alert) error {
+	body, err := json.Marshal(webhookPayload{Alert: a, Summary: Summary(a)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, msg)
+	}
+	return nil
+}
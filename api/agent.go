@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"net/http"
+	"time"
+)
+
+const (
+	// Agents send what they buffered while the server was away in one go,
+	// so reports may be much bigger than pushed statuses.
+	maxAgentReportBytes = 8 << 20 // 8 MiB
+	maxAgentReportItems = 1000
+	agentStoreTimeout   = 30 * time.Second
+	// hostClaimTTL is how long a service name stays taken by the host that
+	// last reported it, after which another host may take it over.
+	hostClaimTTL = 24 * time.Hour
+)
+
+type agentReportResponse struct {
+	Statuses int `json:"statuses"`
+	Metrics  int `json:"metrics"`
+}
+
+// AgentReportHandler stores a data.AgentReport sent by `minator agent`. The
+// token must allow the report's host and every reported service name; the
+// statuses and metrics are stored under that host and published to live
+// subscribers.
+func (h *handler) AgentReportHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return
+	}
+	var report data.AgentReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentReportBytes)).Decode(&report); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must be at most %d bytes", maxAgentReportBytes))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if n := len(report.Statuses) + len(report.Metrics); n == 0 || n > maxAgentReportItems {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("expected between 1 and %d statuses and metrics", maxAgentReportItems))
+		return
+	}
+
+	if !token.AllowsHost(report.Host) {
+		writeError(w, http.StatusForbidden, "token not allowed for this host")
+		return
+	}
+	fields := report.Validate(time.Now())
+	for i, s := range report.Statuses {
+		if !token.Allows(s.Name) {
+			if fields == nil {
+				fields = map[string]string{}
+			}
+			fields[fmt.Sprintf("statuses[%d].name", i)] = "token not allowed for this service"
+		}
+	}
+	if len(fields) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	// Services are identified by name alone, two hosts reporting the same
+	// name would mix up their state, uptime and alerts.
+	clashes, err := h.hostClashes(r.Context(), report)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check service names")
+		return
+	}
+	if len(clashes) > 0 {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: "service names already reported by another host", Fields: clashes})
+		return
+	}
+
+	for i := range report.Statuses {
+		report.Statuses[i].ID = 0
+		report.Statuses[i].Host = report.Host
+	}
+	for i := range report.Metrics {
+		report.Metrics[i].Host = report.Host
+	}
+	if err := h.storeAgentReport(report); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store report")
+		return
+	}
+	writeJSON(w, http.StatusCreated, agentReportResponse{Statuses: len(report.Statuses), Metrics: len(report.Metrics)})
+}
+
+// storeAgentReport persists report and publishes it to live subscribers.
+func (h *handler) storeAgentReport(report data.AgentReport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), agentStoreTimeout)
+	defer cancel()
+	if len(report.Statuses) > 0 {
+		// Buffered statuses may be old, only the newer ones go live.
+		if err := h.insertStatuses(ctx, report.Statuses); err != nil {
+			slog.Error("Failed to insert agent statuses", "host", report.Host, "err", err)
+			return err
+		}
+	}
+	for _, m := range report.Metrics {
+		if err := h.hardwareMetric.InsertHardwareMetrics(ctx, m); err != nil {
+			slog.Error("Failed to insert agent metrics", "host", report.Host, "err", err)
+			return err
+		}
+		h.metricHub.Publish(m)
+	}
+	return nil
+}
+
+// hostClashes returns the statuses of report whose name another host
+// reported within hostClaimTTL. Overdue statuses are written by the
+// heartbeat check on behalf of whoever reports the service, they claim
+// nothing.
+func (h *handler) hostClashes(ctx context.Context, report data.AgentReport) (map[string]string, error) {
+	if len(report.Statuses) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(report.Statuses))
+	for _, s := range report.Statuses {
+		names = append(names, s.Name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	latest, err := h.serviceStatus.GetLatestServiceStatusByName(ctx, names)
+	if err != nil {
+		slog.Error("Failed to get latest service status", "err", err)
+		return nil, err
+	}
+	clashes := map[string]string{}
+	since := time.Now().Add(-hostClaimTTL)
+	for i, s := range report.Statuses {
+		if prev, ok := latest[s.Name]; ok && prev.Status != data.StatusOverdue && prev.Host != report.Host && prev.Timestamp.After(since) {
+			other := prev.Host
+			if other == "" {
+				other = "the push API"
+			}
+			clashes[fmt.Sprintf("statuses[%d].name", i)] = "already reported by " + other
+		}
+	}
+	return clashes, nil
+}
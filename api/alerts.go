@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"minator/alert"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAlerts caps the number of alerts a history query returns.
+const maxAlerts = 1000
+
+// AlertsHandler returns the alerts that were open at some point between
+// ?from= and ?to= (defaults to the last 24 hours), in the order they fired.
+// ?state= keeps alerts currently in one of the given comma separated
+// states: firing, acknowledged or resolved.
+func (h *handler) AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := repository.AlertQuery{From: from, To: to, Limit: maxAlerts}
+	if v := r.URL.Query().Get("state"); v != "" {
+		q.States = strings.Split(v, ",")
+		for _, state := range q.States {
+			if !slices.Contains([]string{"firing", "acknowledged", "resolved"}, state) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'state' %q, expected firing, acknowledged or resolved", state))
+				return
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	alerts, err := h.alert.GetAlerts(ctx, q)
+	if err != nil {
+		slog.Error("Failed to get alerts", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read alerts")
+		return
+	}
+	if alerts == nil {
+		alerts = []data.Alert{}
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+type ackRequest struct {
+	By string `json:"by"`
+}
+
+// AckAlertHandler acknowledges a firing alert, which stops its escalation.
+// The body is optional, {"by": "alice"} records who took it, it defaults
+// to the dashboard user. The request has to be JSON: browsers send the
+// dashboard credentials along with cross-site form posts, but can't set
+// that content type on them without asking the server first.
+func (h *handler) AckAlertHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var req ackRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.By == "" {
+		req.By = "dashboard"
+		if user, _, ok := r.BasicAuth(); ok {
+			req.By = user
+		}
+	}
+	if len(req.By) > data.MaxNameLength || data.HasControlChars(req.By) {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed",
+			Fields: map[string]string{"by": fmt.Sprintf("must be at most %d characters without control characters", data.MaxNameLength)}})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	a, err := h.alerts.Acknowledge(ctx, id, req.By)
+	if errors.Is(err, alert.ErrNotFiring) {
+		writeError(w, http.StatusConflict, "alert is not firing or already acknowledged")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to acknowledge alert", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to acknowledge alert")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
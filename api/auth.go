@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"minator/auth"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"time"
+)
+
+// authenticateToken checks the bearer token of r. On failure the response
+// has already been written and false is returned.
+func (h *handler) authenticateToken(w http.ResponseWriter, r *http.Request) (data.APIToken, bool) {
+	token, ok := auth.BearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="minator"`)
+		writeError(w, http.StatusUnauthorized, "missing bearer token")
+		return data.APIToken{}, false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	t, err := h.apiToken.UseToken(ctx, auth.HashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="minator", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return data.APIToken{}, false
+	}
+	if err != nil {
+		slog.Error("Failed to look up API token", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to check token")
+		return data.APIToken{}, false
+	}
+	return t, true
+}
+
+// RequireDashboardAuth guards dashboard pages and the read APIs behind basic
+// auth, when it is configured.
+func (h *handler) RequireDashboardAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.dashboardAuth.Check(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="minator", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowOrigin sets the CORS header for streams, only if an origin was
+// explicitly allowed through MINATOR_ALLOWED_ORIGIN.
+func (h *handler) allowOrigin(w http.ResponseWriter) {
+	if h.allowedOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", h.allowedOrigin)
+	}
+}
@@ -1,157 +1,232 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
+	"minator/alert"
+	"minator/auth"
 	"minator/data"
+	"minator/hub"
+	"minator/maintenance"
 	"minator/monitor"
 	"minator/repository"
 	"net/http"
+	"os"
 	"time"
 )
 
 type handler struct {
 	serviceStatus  repository.ServiceStatusRepo
 	hardwareMetric repository.HardwareMetricsRepo
+	apiToken       repository.APITokenRepo
+	heartbeat      repository.HeartbeatRepo
+	jobRun         repository.JobRunRepo
+	maintenance    repository.MaintenanceRepo
+	schedule       *maintenance.Schedule
+	alert          repository.AlertRepo
+	alerts         *alert.Manager
+	incident       repository.IncidentRepo
+	statusHub      *hub.Hub[[]data.ServiceStatus]
+	metricHub      *hub.Hub[data.HardwareMetrics]
+	alertHub       *hub.Hub[data.Alert]
+	dependencies   map[string][]string
+	dashboardAuth  auth.BasicAuth
+	allowedOrigin  string
 	tmpl           *template.Template
+	publicServices []string
+	public         publicCache
 }
 
-func NewHandler(ss repository.ServiceStatusRepo, hm repository.HardwareMetricsRepo) *handler {
+// Deps lists everything the handlers need, it is only there to keep
+// NewHandler's signature readable.
+type Deps struct {
+	ServiceStatus  repository.ServiceStatusRepo
+	HardwareMetric repository.HardwareMetricsRepo
+	APIToken       repository.APITokenRepo
+	Heartbeat      repository.HeartbeatRepo
+	JobRun         repository.JobRunRepo
+	Maintenance    repository.MaintenanceRepo
+	Schedule       *maintenance.Schedule
+	Alert          repository.AlertRepo
+	Alerts         *alert.Manager
+	Incident       repository.IncidentRepo
+	StatusHub      *hub.Hub[[]data.ServiceStatus]
+	MetricHub      *hub.Hub[data.HardwareMetrics]
+	AlertHub       *hub.Hub[data.Alert]
+	// Dependencies are the depends_on of the server's checks.
+	Dependencies map[string][]string
+}
+
+func NewHandler(d Deps) *handler {
 	return &handler{
-		serviceStatus:  ss,
-		hardwareMetric: hm,
-		tmpl:           template.Must(template.ParseFiles("templates/status.html")),
+		serviceStatus:  d.ServiceStatus,
+		hardwareMetric: d.HardwareMetric,
+		apiToken:       d.APIToken,
+		heartbeat:      d.Heartbeat,
+		jobRun:         d.JobRun,
+		maintenance:    d.Maintenance,
+		schedule:       d.Schedule,
+		alert:          d.Alert,
+		alerts:         d.Alerts,
+		incident:       d.Incident,
+		statusHub:      d.StatusHub,
+		metricHub:      d.MetricHub,
+		alertHub:       d.AlertHub,
+		dependencies:   d.Dependencies,
+		dashboardAuth:  auth.BasicAuthFromEnv(),
+		allowedOrigin:  os.Getenv("MINATOR_ALLOWED_ORIGIN"),
+		tmpl:           template.Must(template.ParseFiles("templates/status.html", "templates/timeline.html", "templates/public.html")),
+		publicServices: publicServicesFromEnv(),
 	}
 }
 
 func (h *handler) StatusPageHandler(w http.ResponseWriter, r *http.Request) {
-	if err := h.tmpl.Execute(w, nil); err != nil {
+	if err := h.tmpl.ExecuteTemplate(w, "status.html", nil); err != nil {
+		http.Error(w, "Render error", 500)
+	}
+}
+
+// TimelinePageHandler renders the timeline lining up alerts, status changes
+// and hardware metrics over a window.
+func (h *handler) TimelinePageHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.tmpl.ExecuteTemplate(w, "timeline.html", nil); err != nil {
 		http.Error(w, "Render error", 500)
 	}
 }
 
+const (
+	maxPushBodyBytes = 1 << 20 // 1 MiB
+	maxPushBatchSize = 100
+)
+
 // While backup is in progress, it will send a curl command to this server,
 // we will store health status like which backup is done, which is in progress,
 // which fails, ... Then this function will update response on a json file
 // so that StatusPageHandler will use this json to render the html
+//
+// The body is either a single data.ServiceRequest or an array of them. The
+// stored statuses are returned with 201, in the same shape as the request.
 func (m *handler) ServiceStatusHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var payload data.ServiceRequest
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, "invalid JSON", http.StatusBadRequest)
-			slog.Error("Could not decode ServiceRequest", "err", err)
+		token, ok := m.authenticateToken(w, r)
+		if !ok {
+			return
+		}
+		payload, batch, err := decodeServiceRequests(w, r)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must be at most %d bytes", maxPushBodyBytes))
+				return
+			}
+			slog.Warn("Could not decode ServiceRequest", "err", err)
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if len(payload) == 0 || len(payload) > maxPushBatchSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expected between 1 and %d statuses", maxPushBatchSize))
 			return
 		}
-		statuses := []data.ServiceStatus{payload.ToHealthStatus(time.Now())}
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
-		defer cancel()
-		m.serviceStatus.InsertServiceStatus(ctx, statuses)
+		now := time.Now()
+		fields := map[string]string{}
+		for i, p := range payload {
+			for field, msg := range p.Validate(now) {
+				fields[fieldPath(batch, i, field)] = msg
+			}
+			if !token.Allows(p.Name) {
+				fields[fieldPath(batch, i, "name")] = "token not allowed for this service"
+			}
+		}
+		if len(fields) > 0 {
+			writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+			return
+		}
+
+		statuses := make([]data.ServiceStatus, 0, len(payload))
+		for _, p := range payload {
+			statuses = append(statuses, p.ToHealthStatus(now))
+		}
+		if err := m.storeStatuses(statuses); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to store status")
+			return
+		}
+
+		if batch {
+			writeJSON(w, http.StatusCreated, statuses)
+		} else {
+			writeJSON(w, http.StatusCreated, statuses[0])
+		}
 	}
 }
 
-func (m *handler) sendStatuses(flusher http.Flusher, w http.ResponseWriter) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
-	defer cancel()
-	content, err := m.serviceStatus.GetLatestServiceStatus(ctx)
-	if err != nil {
-		slog.Error("Failed to get health status", "err", err)
-		fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
-		flusher.Flush()
-		return
+// decodeServiceRequests reads either a single request or an array of them,
+// batch tells which one it was.
+func decodeServiceRequests(w http.ResponseWriter, r *http.Request) ([]data.ServiceRequest, bool, error) {
+	var raw json.RawMessage
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushBodyBytes))
+	if err := dec.Decode(&raw); err != nil {
+		return nil, false, err
 	}
-	if len(content) < 1 {
-		return
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		var payload []data.ServiceRequest
+		err := json.Unmarshal(trimmed, &payload)
+		return payload, true, err
 	}
-	json, err := data.ServiceStatusToJSON(content)
-	if err != nil {
-		slog.Error("Failed to parse health status to json", "err", err)
-		fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
-		flusher.Flush()
-		return
+	var payload data.ServiceRequest
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, false, err
 	}
-	// Write event to stream
-	fmt.Fprintf(w, "event: update\ndata: %s\n\n", json)
-	flusher.Flush()
+	return []data.ServiceRequest{payload}, false, nil
 }
 
-func (m *handler) StreamServiceStatuses(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("SSE client connected", "event", "ServiceStatus", "remote", r.RemoteAddr)
-		defer slog.Info("SSE client disconnected", "event", "ServiceStatus", "remote", r.RemoteAddr)
-
-		// SSE headers
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-		w.Header().Set("X-Accel-Buffering", "no") // this header ensures the stream isn't buffered if served behind NGINX
-
-		// Allow CORS (only needed if frontend is on a different origin)
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
-		// Flush writer immediately
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
-			return
-		}
-
-		m.sendStatuses(flusher, w)
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				slog.Info("Server disconnected")
-				return
-			case <-r.Context().Done():
-				return // client disconnected
-			case <-ticker.C:
-				m.sendStatuses(flusher, w)
-			}
-		}
+func fieldPath(batch bool, i int, field string) string {
+	if batch {
+		return fmt.Sprintf("[%d].%s", i, field)
 	}
+	return field
 }
 
-func (h *handler) StreamHardwareMetrics(ctx context.Context) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		group := r.URL.Query().Get("group")
-		if group == "" {
-			group = "none"
-		}
-		slog.Info("SSE client connected", "event", "HardwareMetrics", "groupBy", group, "remote", r.RemoteAddr)
-		defer slog.Info("SSE client disconnected", "event", "HardwareMetrics", "groupBy", group, "remote", r.RemoteAddr)
-
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
-
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
-			return
-		}
-
-		var lastTimestamp time.Time
-		lastTimestamp = h.hardwareMetric.GetMetrics(w, flusher, group, lastTimestamp)
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
+// storeStatuses persists statuses and publishes them to live subscribers.
+func (m *handler) storeStatuses(statuses []data.ServiceStatus) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	return m.insertStatuses(ctx, statuses)
+}
 
-		for {
-			select {
-			case <-ctx.Done():
-				slog.Info("Server disconnected")
-				return
-			case <-r.Context().Done():
-				slog.Info("Client disconnected from hardware metrics SSE")
-				return
-			case <-ticker.C:
-				lastTimestamp = h.hardwareMetric.GetMetrics(w, flusher, group, lastTimestamp)
-			}
+// insertStatuses persists statuses and publishes those newer than the latest
+// stored status of their service. Backfilled statuses only go to the
+// database: published, they would replace the current state on the
+// dashboard and fire or resolve alerts on old data.
+func (m *handler) insertStatuses(ctx context.Context, statuses []data.ServiceStatus) error {
+	names := make([]string, 0, len(statuses))
+	for _, s := range statuses {
+		names = append(names, s.Name)
+	}
+	latest, err := m.serviceStatus.GetLatestServiceStatusByName(ctx, names)
+	if err != nil {
+		slog.Error("Failed to get latest service status", "err", err)
+		return err
+	}
+	if err := m.serviceStatus.InsertServiceStatus(ctx, statuses); err != nil {
+		slog.Error("Failed to insert service status", "err", err)
+		return err
+	}
+	var live []data.ServiceStatus
+	for _, s := range statuses {
+		if prev, ok := latest[s.Name]; ok && !s.Timestamp.After(prev.Timestamp) {
+			continue
 		}
+		latest[s.Name] = s
+		live = append(live, s)
+	}
+	if len(live) > 0 {
+		m.statusHub.Publish(live)
 	}
+	return nil
 }
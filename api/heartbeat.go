@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/auth"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type heartbeatRequest struct {
+	Interval     string `json:"interval"`
+	ExpectStatus string `json:"expect_status"`
+}
+
+type heartbeatResponse struct {
+	data.Heartbeat
+	// PingURL is only returned when the heartbeat is created, it can't be
+	// recovered afterwards.
+	PingURL string `json:"ping_url,omitempty"`
+}
+
+// PutHeartbeatHandler declares that a service must report at least every
+// interval, e.g. {"interval": "25h", "expect_status": "success"}. The token
+// must be allowed to report the service.
+func (h *handler) PutHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !token.Allows(name) {
+		writeError(w, http.StatusForbidden, "token not allowed for this service")
+		return
+	}
+	var req heartbeatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	hb := data.Heartbeat{Name: name, ExpectStatus: req.ExpectStatus}
+	if hb.ExpectStatus == "" {
+		hb.ExpectStatus = "success"
+	}
+	interval, err := data.ParseDuration(req.Interval)
+	hb.Interval = interval
+	fields := hb.Validate()
+	if err != nil {
+		if fields == nil {
+			fields = map[string]string{}
+		}
+		fields["interval"] = "must be a duration like 30m, 25h or 7d"
+	}
+	if len(fields) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	pingToken, pingHash, err := auth.NewToken()
+	if err != nil {
+		slog.Error("Failed to generate ping token", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to generate ping token")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	hb, created, err := h.heartbeat.UpsertHeartbeat(ctx, hb, pingHash)
+	if err != nil {
+		slog.Error("Failed to store heartbeat", "name", name, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to store heartbeat")
+		return
+	}
+	if !created {
+		writeJSON(w, http.StatusOK, heartbeatResponse{Heartbeat: hb})
+		return
+	}
+	writeJSON(w, http.StatusCreated, heartbeatResponse{Heartbeat: hb, PingURL: pingURL(r, pingToken)})
+}
+
+func (h *handler) HeartbeatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	heartbeats, err := h.heartbeat.GetHeartbeats(ctx)
+	if err != nil {
+		slog.Error("Failed to get heartbeats", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read heartbeats")
+		return
+	}
+	if heartbeats == nil {
+		heartbeats = []data.Heartbeat{}
+	}
+	writeJSON(w, http.StatusOK, heartbeats)
+}
+
+func (h *handler) DeleteHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !token.Allows(name) {
+		writeError(w, http.StatusForbidden, "token not allowed for this service")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	if err := h.heartbeat.DeleteHeartbeat(ctx, name); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "no such heartbeat")
+			return
+		}
+		slog.Error("Failed to delete heartbeat", "name", name, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete heartbeat")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PingHandler records the expected status of the heartbeat owning the
+// token in the URL, so cron jobs only need to `curl` it. ?status= reports
+// something else, e.g. ?status=failed.
+func (h *handler) PingHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	hb, err := h.heartbeat.GetHeartbeatByToken(ctx, auth.HashToken(r.PathValue("token")))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "unknown ping token")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to look up heartbeat", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to look up heartbeat")
+		return
+	}
+	status := hb.ExpectStatus
+	if v := r.URL.Query().Get("status"); v != "" {
+		if !slices.Contains(data.KnownStatuses, v) {
+			writeError(w, http.StatusBadRequest, "'status' must be one of "+strings.Join(data.KnownStatuses, ", "))
+			return
+		}
+		status = v
+	}
+	statuses := []data.ServiceStatus{{
+		Name:      hb.Name,
+		Status:    status,
+		Detail:    "Heartbeat ping",
+		Timestamp: time.Now(),
+	}}
+	if err := h.storeStatuses(statuses); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store status")
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses[0])
+}
+
+func pingURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/ping/%s", scheme, r.Host, token)
+}
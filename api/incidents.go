@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type incidentRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type incidentUpdateRequest struct {
+	Body string `json:"body"`
+	// Resolved closes the incident, the body is optional then.
+	Resolved bool `json:"resolved"`
+}
+
+// authenticatePublisher lets tokens allowed for every service publish on
+// the public status page, as incidents aren't tied to a service.
+func (h *handler) authenticatePublisher(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return false
+	}
+	if !token.Allows("*") {
+		writeError(w, http.StatusForbidden, "token must be allowed for every service (*)")
+		return false
+	}
+	return true
+}
+
+// CreateIncidentHandler publishes an incident on the public status page.
+func (h *handler) CreateIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticatePublisher(w, r) {
+		return
+	}
+	var req incidentRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	incident := data.Incident{Title: req.Title, Body: req.Body}
+	if fields := incident.Validate(); fields != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	incident, err := h.incident.CreateIncident(ctx, incident)
+	if err != nil {
+		slog.Error("Failed to store incident", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to store incident")
+		return
+	}
+	writeJSON(w, http.StatusCreated, incident)
+}
+
+// AddIncidentUpdateHandler posts a follow-up on an incident and resolves it
+// when asked to. The incident is returned with all its updates.
+func (h *handler) AddIncidentUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticatePublisher(w, r) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var req incidentUpdateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	update := data.IncidentUpdate{Body: req.Body}
+	fields := update.Validate()
+	if req.Resolved && req.Body == "" {
+		fields = nil
+	}
+	if fields != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	if req.Body != "" {
+		_, err = h.incident.AddIncidentUpdate(ctx, id, update)
+	}
+	if err == nil && req.Resolved {
+		err = h.incident.ResolveIncident(ctx, id, time.Now())
+	}
+	var incident data.Incident
+	if err == nil {
+		incident, err = h.incident.GetIncident(ctx, id)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no such incident")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to update incident", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to update incident")
+		return
+	}
+	writeJSON(w, http.StatusOK, incident)
+}
+
+// DeleteIncidentHandler takes an incident, posted by mistake say, off the
+// public status page.
+func (h *handler) DeleteIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticatePublisher(w, r) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	err = h.incident.DeleteIncident(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no such incident")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete incident", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete incident")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
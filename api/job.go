@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxJobSteps bounds the steps of a run, they are all stored in one row
+// and shown on the dashboard.
+const maxJobSteps = 100
+
+var (
+	runIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+	// errRunFinished is returned from run updates once the run is over.
+	errRunFinished = errors.New("run already finished")
+)
+
+type startRunRequest struct {
+	// RunID is optional, scripts can pick their own to avoid having to
+	// keep the one we generate.
+	RunID string   `json:"run_id"`
+	Steps []string `json:"steps"`
+}
+
+type progressRequest struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Bytes  *int64 `json:"bytes"`
+}
+
+type finishRunRequest struct {
+	Status    string `json:"status"`
+	ExitCode  *int   `json:"exit_code"`
+	Bytes     *int64 `json:"bytes"`
+	SizeBytes *int64 `json:"size_bytes"`
+	Message   string `json:"message"`
+}
+
+// StartRunHandler starts a run of the job in the path. Steps listed in the
+// request start out as "pending".
+func (h *handler) StartRunHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+	var req startRunRequest
+	if !decodeJobRequest(w, r, &req) {
+		return
+	}
+	if req.RunID == "" {
+		req.RunID = newRunID()
+	}
+	fields := map[string]string{}
+	if !runIDPattern.MatchString(req.RunID) {
+		fields["run_id"] = "must be 1 to 64 letters, digits, '.', '_' or '-'"
+	}
+	if len(req.Steps) > maxJobSteps {
+		fields["steps"] = fmt.Sprintf("must be at most %d", maxJobSteps)
+	}
+	for i, step := range req.Steps {
+		if msg := validateName(step); msg != "" {
+			fields[fmt.Sprintf("steps[%d]", i)] = msg
+		}
+	}
+	if len(fields) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	now := time.Now()
+	run := data.JobRun{ID: req.RunID, Job: job, Status: "inprogress", StartedAt: now}
+	for _, step := range req.Steps {
+		run.SetStep(data.JobStep{Name: step, Status: "pending", UpdatedAt: now})
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	err := h.jobRun.StartRun(ctx, run)
+	if errors.Is(err, repository.ErrExists) {
+		writeError(w, http.StatusConflict, "a run with this run_id already exists")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to start job run", "job", job, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to start run")
+		return
+	}
+	if err := h.storeStatuses([]data.ServiceStatus{run.ToHealthStatus(now)}); err != nil {
+		writeError(w, http.StatusInternalServerError, "run started but its status could not be stored")
+		return
+	}
+	writeJSON(w, http.StatusCreated, run)
+}
+
+// RunProgressHandler updates one step of a run, adding the step if the run
+// doesn't know it yet.
+func (h *handler) RunProgressHandler(w http.ResponseWriter, r *http.Request) {
+	var req progressRequest
+	h.updateRun(w, r, &req, func(run *data.JobRun, now time.Time) map[string]string {
+		fields := map[string]string{}
+		if msg := validateName(req.Step); msg != "" {
+			fields["step"] = msg
+		} else if len(run.Steps) >= maxJobSteps && !slices.ContainsFunc(run.Steps, func(s data.JobStep) bool { return s.Name == req.Step }) {
+			fields["step"] = fmt.Sprintf("run already has %d steps", maxJobSteps)
+		}
+		if !slices.Contains(data.KnownStatuses, req.Status) && req.Status != "pending" {
+			fields["status"] = "must be one of pending, " + strings.Join(data.KnownStatuses, ", ")
+		}
+		if len(req.Detail) > data.MaxDetailLength {
+			fields["detail"] = fmt.Sprintf("must be at most %d characters", data.MaxDetailLength)
+		}
+		if len(fields) > 0 {
+			return fields
+		}
+		run.SetStep(data.JobStep{Name: req.Step, Status: req.Status, Detail: req.Detail, UpdatedAt: now})
+		if req.Bytes != nil {
+			run.Bytes = req.Bytes
+		}
+		return nil
+	})
+}
+
+// FinishRunHandler ends a run with "success" or "failed".
+func (h *handler) FinishRunHandler(w http.ResponseWriter, r *http.Request) {
+	var req finishRunRequest
+	h.updateRun(w, r, &req, func(run *data.JobRun, now time.Time) map[string]string {
+		if req.Status != "success" && req.Status != "failed" {
+			return map[string]string{"status": "must be success or failed"}
+		}
+		if len(req.Message) > data.MaxDetailLength {
+			return map[string]string{"message": fmt.Sprintf("must be at most %d characters", data.MaxDetailLength)}
+		}
+		run.Status = req.Status
+		run.FinishedAt = &now
+		run.ExitCode = req.ExitCode
+		run.Message = req.Message
+		if req.Bytes != nil {
+			run.Bytes = req.Bytes
+		}
+		if req.SizeBytes != nil {
+			run.SizeBytes = req.SizeBytes
+		}
+		return nil
+	})
+}
+
+// updateRun decodes the request into req and applies update to the run in
+// the path. update returns invalid fields, if any.
+func (h *handler) updateRun(w http.ResponseWriter, r *http.Request, req any, update func(*data.JobRun, time.Time) map[string]string) {
+	job, ok := h.authorizeJob(w, r)
+	if !ok {
+		return
+	}
+	if !decodeJobRequest(w, r, req) {
+		return
+	}
+	now := time.Now()
+	var fields map[string]string
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	run, err := h.jobRun.UpdateRun(ctx, job, r.PathValue("id"), func(run *data.JobRun) error {
+		if run.Finished() {
+			return errRunFinished
+		}
+		if fields = update(run, now); fields != nil {
+			return errors.New("validation failed")
+		}
+		return nil
+	})
+	switch {
+	case fields != nil:
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, http.StatusNotFound, "no such run")
+	case errors.Is(err, errRunFinished):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		slog.Error("Failed to update job run", "job", job, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to update run")
+	default:
+		if err := h.storeStatuses([]data.ServiceStatus{run.ToHealthStatus(now)}); err != nil {
+			writeError(w, http.StatusInternalServerError, "run updated but its status could not be stored")
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	}
+}
+
+// JobRunsHandler lists recent runs, of a single job with ?job=.
+func (h *handler) JobRunsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("'limit' must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	runs, err := h.jobRun.GetRecentRuns(ctx, r.URL.Query().Get("job"), limit)
+	if err != nil {
+		slog.Error("Failed to get job runs", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read job runs")
+		return
+	}
+	if runs == nil {
+		runs = []data.JobRun{}
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// authorizeJob checks that the token may report the job in the path.
+func (h *handler) authorizeJob(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return "", false
+	}
+	job := r.PathValue("job")
+	if msg := validateName(job); msg != "" {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: map[string]string{"job": msg}})
+		return "", false
+	}
+	if !token.Allows(job) {
+		writeError(w, http.StatusForbidden, "token not allowed for this service")
+		return "", false
+	}
+	return job, true
+}
+
+// validateName returns what is wrong with a job or step name, if anything.
+// Job names are service names, steps follow the same rules.
+func validateName(name string) string {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return "is required"
+	case len(name) > data.MaxNameLength:
+		return fmt.Sprintf("must be at most %d characters", data.MaxNameLength)
+	case data.HasControlChars(name):
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+// decodeJobRequest reads a small JSON body into v, an empty body is fine.
+func decodeJobRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
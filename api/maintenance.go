@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type maintenanceRequest struct {
+	Kind     string     `json:"kind"`
+	Title    string     `json:"title"`
+	Services []string   `json:"services"`
+	StartsAt *time.Time `json:"starts_at"`
+	// Either EndsAt or Duration sets how long each occurrence lasts.
+	EndsAt   *time.Time `json:"ends_at"`
+	Duration string     `json:"duration"`
+	Repeat   string     `json:"repeat"`
+	Until    *time.Time `json:"until"`
+}
+
+type maintenanceResponse struct {
+	data.Maintenance
+	Active bool `json:"active"`
+	// Next is the occurrence in progress, or else the next one.
+	Next *data.Interval `json:"next,omitempty"`
+}
+
+// toMaintenance validates req, a missing starts_at meaning now.
+func (req *maintenanceRequest) toMaintenance(now time.Time) (data.Maintenance, map[string]string) {
+	mw := data.Maintenance{Kind: req.Kind, Title: req.Title, Services: req.Services, StartsAt: now, Until: req.Until}
+	if mw.Kind == "" {
+		mw.Kind = data.KindMaintenance
+	}
+	if req.StartsAt != nil {
+		mw.StartsAt = *req.StartsAt
+	}
+	fields := map[string]string{}
+	switch {
+	case req.EndsAt != nil && req.Duration != "":
+		fields["duration"] = "must not be combined with ends_at"
+	case req.EndsAt != nil:
+		mw.Duration = req.EndsAt.Sub(mw.StartsAt)
+	default:
+		d, err := data.ParseDuration(req.Duration)
+		if err != nil {
+			fields["duration"] = "must be a duration like 30m, 2h or 1d"
+		}
+		mw.Duration = d
+	}
+	if req.Repeat != "" {
+		d, err := data.ParseDuration(req.Repeat)
+		if err != nil {
+			fields["repeat"] = "must be a duration like 24h or 7d"
+		}
+		mw.Repeat = d
+	}
+	if len(fields) == 0 {
+		fields = mw.Validate()
+	}
+	return mw, fields
+}
+
+func newMaintenanceResponse(mw data.Maintenance, now time.Time) maintenanceResponse {
+	resp := maintenanceResponse{Maintenance: mw}
+	if next, ok := mw.Next(now); ok {
+		resp.Next = &next
+		resp.Active = !next.Start.After(now)
+	}
+	return resp
+}
+
+// tokenAllowsAll reports whether token may report every service mw applies
+// to, a pattern needing a token allowed for that very pattern (or "*").
+func tokenAllowsAll(token data.APIToken, mw data.Maintenance) bool {
+	for _, s := range mw.Services {
+		if !token.Allows(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// MaintenanceHandler lists the maintenance windows and silences that are in
+// progress or still to come.
+func (h *handler) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	now := time.Now()
+	windows, err := h.maintenance.ListMaintenance(ctx, now)
+	if err != nil {
+		slog.Error("Failed to get maintenance windows", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read maintenance windows")
+		return
+	}
+	resp := make([]maintenanceResponse, 0, len(windows))
+	for _, mw := range windows {
+		resp = append(resp, newMaintenanceResponse(mw, now))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateMaintenanceHandler schedules a window, e.g. {"services": ["forgejo"],
+// "starts_at": "...", "duration": "1h", "repeat": "7d"}, or silences alerts
+// right away with {"kind": "silence", "services": ["backup-*"], "duration":
+// "2h"}. The token must be allowed to report every service listed.
+func (h *handler) CreateMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return
+	}
+	var req maintenanceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	now := time.Now()
+	mw, fields := req.toMaintenance(now)
+	if len(fields) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	if !tokenAllowsAll(token, mw) {
+		writeError(w, http.StatusForbidden, "token not allowed for these services")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	mw, err := h.maintenance.CreateMaintenance(ctx, mw)
+	if err != nil {
+		slog.Error("Failed to store maintenance window", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to store maintenance window")
+		return
+	}
+	h.schedule.Invalidate()
+	writeJSON(w, http.StatusCreated, newMaintenanceResponse(mw, now))
+}
+
+// DeleteMaintenanceHandler ends a window or silence early and forgets about
+// it, past occurrences then count towards uptime again.
+func (h *handler) DeleteMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := h.authenticateToken(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	mw, err := h.maintenance.GetMaintenance(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "no such maintenance window")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get maintenance window", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read maintenance window")
+		return
+	}
+	if !tokenAllowsAll(token, mw) {
+		writeError(w, http.StatusForbidden, "token not allowed for these services")
+		return
+	}
+	if err := h.maintenance.DeleteMaintenance(ctx, id); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("Failed to delete maintenance window", "id", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete maintenance window")
+		return
+	}
+	h.schedule.Invalidate()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// maxMetricPoints caps the number of buckets a single query may produce.
+const maxMetricPoints = 5000
+
+type metricSeries struct {
+	From   time.Time              `json:"from"`
+	To     time.Time              `json:"to"`
+	Step   string                 `json:"step"`
+	Agg    string                 `json:"agg"`
+	Points []data.HardwareMetrics `json:"points"`
+}
+
+// HardwareMetricsHandler returns hardware metrics of ?host= (this server by
+// default) between ?from= and ?to= (defaults to the last 24 hours) aggregated into ?step= sized buckets with
+// ?agg= (avg, min, max or p95, defaults to avg). Without a step, one minute
+// is used, or whatever is needed to stay below maxMetricPoints.
+func (h *handler) HardwareMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseMetricsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	points, err := h.hardwareMetric.QueryMetrics(ctx, q)
+	if err != nil {
+		slog.Error("Failed to query hardware metrics", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to query hardware metrics")
+		return
+	}
+	if points == nil {
+		points = []data.HardwareMetrics{}
+	}
+	writeJSON(w, http.StatusOK, metricSeries{From: q.From, To: q.To, Step: q.Step.String(), Agg: q.Agg, Points: points})
+}
+
+type diskSeries struct {
+	From   time.Time                   `json:"from"`
+	To     time.Time                   `json:"to"`
+	Step   string                      `json:"step"`
+	Agg    string                      `json:"agg"`
+	Mounts map[string][]data.DiskPoint `json:"mounts"`
+}
+
+// DiskMetricsHandler returns disk usage per mount point, with the same
+// query parameters as HardwareMetricsHandler. ?mount= may be repeated to
+// only return some mounts.
+func (h *handler) DiskMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseMetricsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	mounts, err := h.hardwareMetric.QueryDiskMetrics(ctx, q, r.URL.Query()["mount"])
+	if err != nil {
+		slog.Error("Failed to query disk metrics", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to query disk metrics")
+		return
+	}
+	writeJSON(w, http.StatusOK, diskSeries{From: q.From, To: q.To, Step: q.Step.String(), Agg: q.Agg, Mounts: mounts})
+}
+
+type sampleSeries struct {
+	From   time.Time           `json:"from"`
+	To     time.Time           `json:"to"`
+	Step   string              `json:"step"`
+	Agg    string              `json:"agg"`
+	Series []data.SampleSeries `json:"series"`
+}
+
+// HostMetricsHandler returns load, swap, network, disk I/O and temperature
+// series, with the same query parameters as HardwareMetricsHandler. ?name=
+// may be repeated to only return some metrics.
+func (h *handler) HostMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseMetricsQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	series, err := h.hardwareMetric.QuerySamples(ctx, q, r.URL.Query()["name"])
+	if err != nil {
+		slog.Error("Failed to query host metrics", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to query host metrics")
+		return
+	}
+	writeJSON(w, http.StatusOK, sampleSeries{From: q.From, To: q.To, Step: q.Step.String(), Agg: q.Agg, Series: series})
+}
+
+// parseMetricsQuery reads ?host=, ?from=, ?to=, ?step= and ?agg= as
+// documented on HardwareMetricsHandler.
+func parseMetricsQuery(r *http.Request) (repository.MetricsQuery, error) {
+	from, to, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		return repository.MetricsQuery{}, err
+	}
+	span := to.Sub(from)
+
+	step := max(time.Minute, (span/maxMetricPoints).Round(time.Second)+time.Second)
+	if v := r.URL.Query().Get("step"); v != "" {
+		if step, err = parseStep(v); err != nil {
+			return repository.MetricsQuery{}, err
+		}
+		if span/step > maxMetricPoints {
+			return repository.MetricsQuery{}, fmt.Errorf("step too small, range would produce more than %d points", maxMetricPoints)
+		}
+	}
+
+	agg := r.URL.Query().Get("agg")
+	if agg == "" {
+		agg = "avg"
+	}
+	if !repository.ValidAggregation(agg) {
+		return repository.MetricsQuery{}, fmt.Errorf("'agg' must be one of avg, min, max, p95")
+	}
+	return repository.MetricsQuery{Host: queryHost(r), From: from, To: to, Step: step, Agg: agg}, nil
+}
+
+// parseStep parses a bucket size, see data.ParseDuration.
+func parseStep(v string) (time.Duration, error) {
+	step, err := data.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid 'step': %q", v)
+	}
+	if step < time.Second {
+		return 0, fmt.Errorf("'step' must be at least 1s")
+	}
+	return step, nil
+}
+
+type hostList struct {
+	Local string   `json:"local"`
+	Hosts []string `json:"hosts"`
+}
+
+// HostsHandler lists the hosts that reported metrics over the last week,
+// local is the host this server reports as.
+func (h *handler) HostsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	hosts, err := h.hardwareMetric.ListHosts(ctx, time.Now().Add(-7*24*time.Hour))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list hosts")
+		return
+	}
+	local := monitor.Hostname()
+	if !slices.Contains(hosts, local) {
+		hosts = append(hosts, local)
+		slices.Sort(hosts)
+	}
+	writeJSON(w, http.StatusOK, hostList{Local: local, Hosts: hosts})
+}
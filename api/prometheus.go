@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"minator/telemetry"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// staleMetricsAfter hides hosts that stopped reporting from /metrics.
+const staleMetricsAfter = 5 * time.Minute
+
+// family collects the samples of one metric so they are written together,
+// as the text format requires.
+type family struct {
+	help, typ string
+	samples   []familySample
+}
+
+type familySample struct {
+	labels map[string]string
+	value  float64
+}
+
+type families map[string]*family
+
+func (f families) add(name, help, typ string, labels map[string]string, value float64) {
+	fam, ok := f[name]
+	if !ok {
+		fam = &family{help: help, typ: typ}
+		f[name] = fam
+	}
+	fam.samples = append(fam.samples, familySample{labels, value})
+}
+
+func (f families) write(buf *bytes.Buffer) {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fam := f[name]
+		telemetry.WriteHeader(buf, name, fam.help, fam.typ)
+		for _, s := range fam.samples {
+			telemetry.WriteSample(buf, name, s.labels, s.value)
+		}
+	}
+}
+
+// PrometheusHandler exposes the current service statuses, the latest
+// hardware metrics of every host and Minator's own counters in the
+// Prometheus text format.
+func (h *handler) PrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	statuses, err := h.serviceStatus.GetLatestServiceStatus(ctx)
+	if err != nil {
+		http.Error(w, "failed to read service statuses", http.StatusInternalServerError)
+		return
+	}
+	metrics, err := h.hardwareMetric.GetLatestMetrics(ctx, time.Now().Add(-staleMetricsAfter))
+	if err != nil {
+		slog.Error("Failed to read latest hardware metrics", "err", err)
+		http.Error(w, "failed to read hardware metrics", http.StatusInternalServerError)
+		return
+	}
+
+	f := families{}
+	for _, s := range statuses {
+		labels := map[string]string{"name": s.Name, "host": s.Host}
+		up := 1.0
+		if data.IsDown(s.Status) {
+			up = 0
+		}
+		f.add("minator_service_up", "Whether the service's latest status is not a down status.", "gauge", labels, up)
+		f.add("minator_service_status", "Latest status of the service, the value is always 1.", "gauge",
+			map[string]string{"name": s.Name, "host": s.Host, "status": s.Status}, 1)
+		f.add("minator_service_last_status_timestamp_seconds", "When the latest status was recorded.", "gauge",
+			labels, float64(s.Timestamp.UnixMilli())/1000)
+	}
+	for _, m := range metrics {
+		addHardware(f, m)
+	}
+
+	var buf bytes.Buffer
+	f.write(&buf)
+	for _, v := range telemetry.All {
+		v.Write(&buf)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func addHardware(f families, m data.HardwareMetrics) {
+	host := map[string]string{"host": m.Host}
+	for name, v := range map[string]*float64{
+		"minator_cpu_percent":  m.CPUPercent,
+		"minator_ram_percent":  m.RAMPercent,
+		"minator_disk_percent": m.DiskPercent,
+	} {
+		// Metrics that couldn't be collected are left out rather than 0.
+		if v != nil {
+			f.add(name, "Latest hardware metric of the host.", "gauge", host, *v)
+		}
+	}
+	for _, d := range m.Disks {
+		labels := map[string]string{"host": m.Host, "mountpoint": d.Mountpoint, "device": d.Device}
+		f.add("minator_disk_used_percent", "Used space of the mount point.", "gauge", labels, d.UsedPercent)
+		f.add("minator_disk_inodes_used_percent", "Used inodes of the mount point.", "gauge", labels, d.InodesUsedPercent)
+		f.add("minator_disk_used_bytes", "Used bytes of the mount point.", "gauge", labels, float64(d.UsedBytes))
+		f.add("minator_disk_total_bytes", "Size of the mount point.", "gauge", labels, float64(d.TotalBytes))
+	}
+	for _, s := range m.Samples {
+		labels := map[string]string{"host": m.Host}
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		f.add("minator_host_"+s.Name, "Latest host metric, see the README.", "gauge", labels, s.Value)
+	}
+}
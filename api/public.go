@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// publicDays is the number of daily uptime bars of the public page.
+	publicDays = 90
+	// publicIncidentDays is how long resolved incidents stay listed.
+	publicIncidentDays = 14
+	// publicCacheTTL keeps the public page, which anyone can hit, from
+	// scanning 90 days of statuses on every request.
+	publicCacheTTL = time.Minute
+	// publicRetryDelay is how long a failed refresh waits before the next.
+	publicRetryDelay = 10 * time.Second
+	// publicRefreshTimeout bounds a whole refresh, which reads 90 days of
+	// statuses of every public service.
+	publicRefreshTimeout = time.Minute
+)
+
+// States of the public status page, from best to worst.
+const (
+	publicOperational = "operational"
+	publicMaintenance = "maintenance"
+	publicDegraded    = "degraded"
+	publicOutage      = "outage"
+)
+
+var publicSeverity = map[string]int{publicOperational: 0, publicMaintenance: 1, publicDegraded: 2, publicOutage: 3}
+
+type publicDay struct {
+	Date          string   `json:"date"`
+	UptimePercent *float64 `json:"uptime_percent"`
+}
+
+type publicService struct {
+	Name          string      `json:"name"`
+	State         string      `json:"state"`
+	UptimePercent *float64    `json:"uptime_percent"`
+	Days          []publicDay `json:"days"`
+}
+
+// publicStatus only tells the state of each service, never the detail or
+// host of its checks.
+type publicStatus struct {
+	State     string          `json:"state"`
+	Services  []publicService `json:"services"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// publicCache holds the last computed status. It is refreshed in the
+// background by a single goroutine at a time, requests never wait for it
+// once a first status is loaded.
+type publicCache struct {
+	mu      sync.Mutex
+	status  publicStatus
+	loaded  bool
+	expires time.Time
+	// refreshing is closed when the refresh in progress, if any, is done.
+	refreshing chan struct{}
+}
+
+// publicServicesFromEnv reads the names or patterns of the services shown
+// on the public page from MINATOR_PUBLIC_SERVICES (comma separated). None
+// are shown by default, internal services must not leak by accident.
+func publicServicesFromEnv() []string {
+	var patterns []string
+	for _, p := range strings.Split(os.Getenv("MINATOR_PUBLIC_SERVICES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+func (h *handler) isPublic(name string) bool {
+	for _, pattern := range h.publicServices {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicPageHandler renders the read-only status page meant for users.
+func (h *handler) PublicPageHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.tmpl.ExecuteTemplate(w, "public.html", nil); err != nil {
+		http.Error(w, "Render error", 500)
+	}
+}
+
+// PublicStatusHandler returns the state of the public services and their
+// uptime over the last 90 days, per day. It serves the cached status and
+// starts a refresh when it is stale, only the very first request waits for
+// one.
+func (h *handler) PublicStatusHandler(w http.ResponseWriter, r *http.Request) {
+	h.public.mu.Lock()
+	if time.Now().After(h.public.expires) && h.public.refreshing == nil {
+		h.public.refreshing = make(chan struct{})
+		go h.refreshPublicStatus(h.public.refreshing)
+	}
+	status, loaded, refreshing := h.public.status, h.public.loaded, h.public.refreshing
+	h.public.mu.Unlock()
+
+	if !loaded && refreshing != nil {
+		select {
+		case <-refreshing:
+		case <-r.Context().Done():
+			return
+		}
+		h.public.mu.Lock()
+		status, loaded = h.public.status, h.public.loaded
+		h.public.mu.Unlock()
+	}
+	if !loaded {
+		writeError(w, http.StatusInternalServerError, "failed to read service status")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, http.StatusOK, status)
+}
+
+// refreshPublicStatus computes the public status and closes done. On error
+// the previous status keeps being served and the refresh is retried after
+// publicRetryDelay.
+func (h *handler) refreshPublicStatus(done chan struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), publicRefreshTimeout)
+	defer cancel()
+	now := time.Now()
+	status, err := h.publicStatus(ctx, now)
+
+	h.public.mu.Lock()
+	defer h.public.mu.Unlock()
+	h.public.refreshing = nil
+	if err != nil {
+		h.public.expires = now.Add(publicRetryDelay)
+		return
+	}
+	h.public.status, h.public.loaded, h.public.expires = status, true, now.Add(publicCacheTTL)
+}
+
+func (h *handler) publicStatus(ctx context.Context, now time.Time) (publicStatus, error) {
+	latest, err := h.serviceStatus.GetLatestServiceStatus(ctx)
+	if err != nil {
+		slog.Error("Failed to get latest service status", "err", err)
+		return publicStatus{}, err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	first := today.AddDate(0, 0, -(publicDays - 1))
+
+	status := publicStatus{State: publicOperational, Services: []publicService{}, UpdatedAt: now}
+	for _, s := range latest {
+		if !h.isPublic(s.Name) {
+			continue
+		}
+		svc, err := h.publicService(ctx, s, first, now)
+		if err != nil {
+			return publicStatus{}, err
+		}
+		if publicSeverity[svc.State] > publicSeverity[status.State] {
+			status.State = svc.State
+		}
+		status.Services = append(status.Services, svc)
+	}
+	return status, nil
+}
+
+// publicService computes the uptime of latest's service per day from first
+// to now, the same way as its uptime endpoint does.
+func (h *handler) publicService(ctx context.Context, latest data.ServiceStatus, first, now time.Time) (publicService, error) {
+	statuses, err := h.serviceStatus.GetServiceStatusRange(ctx, latest.Name, first, now)
+	if err != nil {
+		slog.Error("Failed to get service status history", "name", latest.Name, "err", err)
+		return publicService{}, err
+	}
+	excluded, err := h.schedule.Excluded(ctx, latest.Name, first, now)
+	if err != nil {
+		slog.Error("Failed to get maintenance windows", "name", latest.Name, "err", err)
+		return publicService{}, err
+	}
+
+	svc := publicService{Name: latest.Name, State: publicState(latest.Status), Days: make([]publicDay, publicDays)}
+	var up, down float64
+	for n := range svc.Days {
+		from := first.AddDate(0, 0, n)
+		to := from.AddDate(0, 0, 1)
+		if to.After(now) {
+			to = now
+		}
+		u := data.ComputeUptime(latest.Name, daySlice(statuses, from, to), from, to, data.UptimeMaxGap, excluded)
+		svc.Days[n] = publicDay{Date: from.Format(time.DateOnly), UptimePercent: u.UptimePercent}
+		up, down = up+u.UptimeSec, down+u.DowntimeSec
+	}
+	if up+down > 0 {
+		pct := up / (up + down) * 100
+		svc.UptimePercent = &pct
+	}
+	return svc, nil
+}
+
+// daySlice returns the statuses ComputeUptime needs for [from, to): those
+// within it, preceded by the last one before from.
+func daySlice(statuses []data.ServiceStatus, from, to time.Time) []data.ServiceStatus {
+	lo := sort.Search(len(statuses), func(i int) bool { return !statuses[i].Timestamp.Before(from) })
+	hi := sort.Search(len(statuses), func(i int) bool { return !statuses[i].Timestamp.Before(to) })
+	if lo > 0 {
+		lo--
+	}
+	return statuses[lo:hi]
+}
+
+func publicState(status string) string {
+	switch {
+	case status == data.StatusMaintenance:
+		return publicMaintenance
+	case data.IsDown(status):
+		return publicOutage
+	case strings.ToLower(status) == "degraded":
+		return publicDegraded
+	default:
+		return publicOperational
+	}
+}
+
+// PublicIncidentsHandler returns the open incidents and those resolved in
+// the last publicIncidentDays, newest first.
+func (h *handler) PublicIncidentsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	incidents, err := h.incident.ListIncidents(ctx, time.Now().AddDate(0, 0, -publicIncidentDays))
+	if err != nil {
+		slog.Error("Failed to get incidents", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read incidents")
+		return
+	}
+	if incidents == nil {
+		incidents = []data.Incident{}
+	}
+	writeJSON(w, http.StatusOK, incidents)
+}
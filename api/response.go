@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+	// Fields maps invalid request fields to what is wrong with them.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write JSON response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// parseTimeRange reads ?from= and ?to= as RFC 3339 timestamps. A missing to
+// means now, a missing from means window before to.
+func parseTimeRange(r *http.Request, window time.Duration) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid 'to': %v", err)
+		}
+		to = t
+	}
+	from := to.Add(-window)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid 'from': %v", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' must be before 'to'")
+	}
+	return from, to, nil
+}
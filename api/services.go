@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"maps"
+	"minator/data"
+	"minator/monitor"
+	"minator/repository"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+type historyPage struct {
+	Items      []data.ServiceStatus `json:"items"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// ServicesHandler returns the latest known status of every service.
+func (h *handler) ServicesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	statuses, err := h.serviceStatus.GetLatestServiceStatus(ctx)
+	if err != nil {
+		slog.Error("Failed to get latest service statuses", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read service statuses")
+		return
+	}
+	if statuses == nil {
+		statuses = []data.ServiceStatus{}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+type dependencyEdge struct {
+	Service   string `json:"service"`
+	DependsOn string `json:"depends_on"`
+}
+
+// DependenciesHandler returns the dependencies declared between the
+// server's checks, one edge per depends_on entry.
+func (h *handler) DependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	edges := []dependencyEdge{}
+	for _, name := range slices.Sorted(maps.Keys(h.dependencies)) {
+		for _, dep := range h.dependencies[name] {
+			edges = append(edges, dependencyEdge{Service: name, DependsOn: dep})
+		}
+	}
+	writeJSON(w, http.StatusOK, edges)
+}
+
+// ServiceHistoryHandler pages through the status history of a service,
+// newest first. Supported query parameters:
+//   - from, to: RFC 3339 time range, defaults to the last 24 hours
+//   - status: comma separated list of statuses to keep
+//   - limit: page size, at most maxHistoryLimit
+//   - cursor: next_cursor of the previous page
+func (h *handler) ServiceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := repository.StatusHistoryQuery{
+		Name:  r.PathValue("name"),
+		From:  from,
+		To:    to,
+		Limit: defaultHistoryLimit,
+	}
+	params := r.URL.Query()
+	if v := params.Get("status"); v != "" {
+		q.Statuses = strings.Split(v, ",")
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("'limit' must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+		q.Limit = limit
+	}
+	if v := params.Get("cursor"); v != "" {
+		if q.BeforeTimestamp, q.BeforeID, err = decodeCursor(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid 'cursor'")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	// Ask for one extra row to find out whether there is another page.
+	limit := q.Limit
+	q.Limit++
+	statuses, err := h.serviceStatus.GetServiceStatusHistory(ctx, q)
+	if err != nil {
+		slog.Error("Failed to get service status history", "name", q.Name, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read service status history")
+		return
+	}
+	page := historyPage{Items: statuses}
+	if len(statuses) > limit {
+		page.Items = statuses[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(last.Timestamp, last.ID)
+	}
+	if page.Items == nil {
+		page.Items = []data.ServiceStatus{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// maxTransitions caps the number of status changes returned at once.
+const maxTransitions = 5000
+
+// TransitionsHandler returns the status changes of every service between
+// ?from= and ?to= (defaults to the last 24 hours), oldest first. The first
+// status of each service in the range is included so the state it was in
+// is known from the start.
+func (h *handler) TransitionsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	statuses, err := h.serviceStatus.GetStatusTransitions(ctx, from, to, maxTransitions)
+	if err != nil {
+		slog.Error("Failed to get status transitions", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read status transitions")
+		return
+	}
+	if statuses == nil {
+		statuses = []data.ServiceStatus{}
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// Cursors are opaque to clients, they hold the position of the last row
+// of a page so the next one can continue right after it.
+func encodeCursor(ts time.Time, id int64) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", ts.UnixNano(), id))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	tsPart, idPart, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return time.Unix(0, nanos), id, nil
+}
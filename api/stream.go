@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"minator/hub"
+	"minator/monitor"
+	"minator/repository"
+	"minator/telemetry"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseHeartbeatInterval keeps idle connections busy enough for proxies not
+// to close them.
+const sseHeartbeatInterval = 15 * time.Second
+
+// lastEventID returns the ID sent by a reconnecting EventSource, or 0.
+func lastEventID(r *http.Request) uint64 {
+	id, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	return id
+}
+
+// writeEvent writes a single SSE frame. Empty event means the default
+// "message" type and a zero id leaves the client's last event ID untouched.
+func writeEvent(w http.ResponseWriter, f http.Flusher, id uint64, event string, payload []byte) {
+	if id != 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(w, "event: %s\n", event)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+	f.Flush()
+}
+
+func writeHeartbeat(w http.ResponseWriter, f http.Flusher) {
+	fmt.Fprint(w, ": heartbeat\n\n")
+	f.Flush()
+}
+
+// sendLatestStatuses writes the latest known status of every service as a
+// single update event.
+func (m *handler) sendLatestStatuses(flusher http.Flusher, w http.ResponseWriter, id uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	content, err := m.serviceStatus.GetLatestServiceStatus(ctx)
+	if err != nil {
+		slog.Error("Failed to get health status", "err", err)
+		fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+		flusher.Flush()
+		return
+	}
+	sendStatuses(flusher, w, id, content)
+}
+
+func sendStatuses(flusher http.Flusher, w http.ResponseWriter, id uint64, statuses []data.ServiceStatus) {
+	if len(statuses) < 1 {
+		return
+	}
+	json, err := data.ServiceStatusToJSON(statuses)
+	if err != nil {
+		slog.Error("Failed to parse health status to json", "err", err)
+		fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+		flusher.Flush()
+		return
+	}
+	writeEvent(w, flusher, id, "update", []byte(json))
+}
+
+// StreamServiceStatuses sends the latest status of every service once, then
+// every batch of statuses as it gets published. A client reconnecting with
+// Last-Event-ID only gets the batches it missed.
+func (m *handler) StreamServiceStatuses(ctx context.Context) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("SSE client connected", "event", "ServiceStatus", "remote", r.RemoteAddr)
+		defer slog.Info("SSE client disconnected", "event", "ServiceStatus", "remote", r.RemoteAddr)
+		telemetry.StreamClients.Inc("sse-service-statuses")
+		defer telemetry.StreamClients.Dec("sse-service-statuses")
+
+		// SSE headers
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no") // this header ensures the stream isn't buffered if served behind NGINX
+
+		// Allow CORS (only needed if frontend is on a different origin)
+		m.allowOrigin(w)
+
+		// Flush writer immediately
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		// Subscribe before reading the snapshot so nothing published in
+		// between gets lost. Everything up to sub.LastID has been stored
+		// before being published, so the snapshot already covers it.
+		seen := lastEventID(r)
+		sub, caughtUp := m.statusHub.Subscribe(seen)
+		defer sub.Close()
+		if !caughtUp {
+			m.sendLatestStatuses(flusher, w, sub.LastID)
+			seen = sub.LastID
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Server disconnected")
+				return
+			case <-r.Context().Done():
+				return // client disconnected
+			case <-heartbeat.C:
+				writeHeartbeat(w, flusher)
+			case e, ok := <-sub.C:
+				if !ok {
+					return // too slow, the client will reconnect
+				}
+				if e.ID <= seen {
+					continue
+				}
+				sendStatuses(flusher, w, e.ID, e.Value)
+			}
+		}
+	}
+}
+
+// sendMetrics streams every metric newer than lastTimestamp and returns the
+// timestamp of the newest one sent. The last metric is tagged with id.
+func (h *handler) sendMetrics(flusher http.Flusher, w http.ResponseWriter, host, group string, lastTimestamp time.Time, id uint64) time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	metrics, err := h.hardwareMetric.GetMetrics(ctx, host, group, lastTimestamp)
+	if err != nil {
+		slog.Error("Failed to get hardware metrics", "group", group, "err", err)
+		fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
+		flusher.Flush()
+		return lastTimestamp
+	}
+	newest := lastTimestamp
+	for i, metric := range metrics {
+		var metricID uint64
+		if i == len(metrics)-1 {
+			metricID = id
+		}
+		sendMetric(w, flusher, metricID, metric)
+		if metric.Timestamp.After(newest) {
+			newest = metric.Timestamp
+		}
+	}
+	return newest
+}
+
+// sendMetric marshals metric and writes it as an SSE message.
+func sendMetric(w http.ResponseWriter, f http.Flusher, id uint64, metric data.HardwareMetrics) {
+	b, err := json.Marshal(metric)
+	if err != nil {
+		slog.Error("Failed to marshal metric", "error", err)
+		return
+	}
+	writeEvent(w, f, id, "", b)
+}
+
+// StreamHardwareMetrics sends the recent history of ?host= (this server by
+// default) from the database, then follows published metrics. With a group other than "none", published
+// metrics are averaged per period and sent once the period is over.
+//
+// A client reconnecting with Last-Event-ID skips the history and only gets
+// what it missed, as long as that is still in the hub's replay buffer.
+func (h *handler) StreamHardwareMetrics(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group := r.URL.Query().Get("group")
+		if group == "" {
+			group = "none"
+		}
+		if !repository.ValidGroup(group) {
+			writeError(w, http.StatusBadRequest, "'group' must be one of none, minute, hour, day, month")
+			return
+		}
+		host := queryHost(r)
+		slog.Info("SSE client connected", "event", "HardwareMetrics", "groupBy", group, "remote", r.RemoteAddr)
+		defer slog.Info("SSE client disconnected", "event", "HardwareMetrics", "groupBy", group, "remote", r.RemoteAddr)
+		telemetry.StreamClients.Inc("sse-hardware-metrics")
+		defer telemetry.StreamClients.Dec("sse-hardware-metrics")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		h.allowOrigin(w)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		seen := lastEventID(r)
+		sub, caughtUp := h.metricHub.Subscribe(seen)
+		defer sub.Close()
+		var lastTimestamp time.Time
+		if !caughtUp {
+			lastTimestamp = h.sendMetrics(flusher, w, host, group, time.Time{}, sub.LastID)
+			seen = sub.LastID
+		}
+		var bucket metricBucket
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				slog.Info("Server disconnected")
+				return
+			case <-r.Context().Done():
+				slog.Info("Client disconnected from hardware metrics SSE")
+				return
+			case <-heartbeat.C:
+				writeHeartbeat(w, flusher)
+			case e, ok := <-sub.C:
+				if !ok {
+					return // too slow, the client will reconnect
+				}
+				metric := e.Value
+				if metric.Host != host {
+					continue
+				}
+				if e.ID <= seen || !metric.Timestamp.After(lastTimestamp) {
+					continue // already part of the initial batch
+				}
+				if group == "none" {
+					sendMetric(w, flusher, e.ID, metric)
+					lastTimestamp = metric.Timestamp
+					continue
+				}
+				// The initial batch ends with the period still in progress,
+				// don't send that one a second time.
+				if avg, done := bucket.add(group, e.ID, metric); done && avg.Value.Timestamp.After(lastTimestamp) {
+					sendMetric(w, flusher, avg.ID, avg.Value)
+					lastTimestamp = avg.Value.Timestamp
+				}
+			}
+		}
+	}
+}
+
+// metricBucket averages metrics belonging to the same group period.
+type metricBucket struct {
+	start          time.Time
+	lastID         uint64
+	n              int
+	cpu, ram, disk avgValue
+}
+
+// avgValue averages the values that were collected, like SQL's AVG ignores
+// NULL.
+type avgValue struct {
+	sum float64
+	n   int
+}
+
+func (a *avgValue) add(v *float64) {
+	if v != nil {
+		a.sum += *v
+		a.n++
+	}
+}
+
+func (a avgValue) value() *float64 {
+	if a.n == 0 {
+		return nil
+	}
+	v := a.sum / float64(a.n)
+	return &v
+}
+
+// add accumulates metric. When metric starts a new period, the average of
+// the previous one is returned along with true. The average carries the ID
+// of the last event in its period, so a client resuming from it starts
+// exactly with the next period.
+func (b *metricBucket) add(group string, id uint64, metric data.HardwareMetrics) (hub.Event[data.HardwareMetrics], bool) {
+	start := truncateToGroup(metric.Timestamp, group)
+	var avg hub.Event[data.HardwareMetrics]
+	done := false
+	if b.n > 0 && !start.Equal(b.start) {
+		avg = hub.Event[data.HardwareMetrics]{
+			ID: b.lastID,
+			Value: data.HardwareMetrics{
+				CPUPercent:  b.cpu.value(),
+				RAMPercent:  b.ram.value(),
+				DiskPercent: b.disk.value(),
+				Timestamp:   b.start,
+			},
+		}
+		done = true
+		*b = metricBucket{}
+	}
+	if b.n == 0 {
+		b.start = start
+	}
+	b.n++
+	b.lastID = id
+	b.cpu.add(metric.CPUPercent)
+	b.ram.add(metric.RAMPercent)
+	b.disk.add(metric.DiskPercent)
+	return avg, done
+}
+
+// truncateToGroup mirrors postgres' date_trunc for the supported groups.
+func truncateToGroup(t time.Time, group string) time.Time {
+	y, mo, d := t.Date()
+	switch group {
+	case "minute":
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case "hour":
+		return time.Date(y, mo, d, t.Hour(), 0, 0, 0, t.Location())
+	case "day":
+		return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(y, mo, 1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// queryHost returns ?host=, defaulting to the host this server reports as.
+func queryHost(r *http.Request) string {
+	if host := r.URL.Query().Get("host"); host != "" {
+		return host
+	}
+	return monitor.Hostname()
+}
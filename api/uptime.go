@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"minator/data"
+	"minator/monitor"
+	"net/http"
+	"time"
+)
+
+// ServiceUptimeHandler reports availability of a single service between
+// ?from= and ?to= (defaults to the last 24 hours). Optional ?max_gap= (a Go
+// duration) tells how long a sample stays valid, which is useful for
+// services that only push now and then. Maintenance windows are left out.
+func (h *handler) ServiceUptimeHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	from, to, err := parseTimeRange(r, 24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+	if from.After(to) {
+		writeError(w, http.StatusBadRequest, "'from' must be in the past")
+		return
+	}
+	maxGap := data.UptimeMaxGap
+	if v := r.URL.Query().Get("max_gap"); v != "" {
+		if maxGap, err = time.ParseDuration(v); err != nil || maxGap <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid 'max_gap'")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+	defer cancel()
+	statuses, err := h.serviceStatus.GetServiceStatusRange(ctx, name, from, to)
+	if err != nil {
+		slog.Error("Failed to get service status history", "name", name, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read service status history")
+		return
+	}
+	excluded, err := h.schedule.Excluded(ctx, name, from, to)
+	if err != nil {
+		slog.Error("Failed to get maintenance windows", "name", name, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to read maintenance windows")
+		return
+	}
+	writeJSON(w, http.StatusOK, data.ComputeUptime(name, statuses, from, to, maxGap, excluded))
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"minator/data"
+	"minator/hub"
+	"minator/monitor"
+	"minator/telemetry"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+// Topics a WebSocket client can subscribe to.
+const (
+	topicStatuses = "statuses"
+	topicMetrics  = "metrics"
+	topicAlerts   = "alerts"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// wsCommand is what clients send, e.g.
+//
+//	{"action": "subscribe", "topic": "metrics", "group": "hour", "host": "nas"}
+//
+// Subscribing to metrics again with another group or host switches without
+// reconnecting. Host defaults to this server.
+type wsCommand struct {
+	Action string `json:"action"` // "subscribe" or "unsubscribe"
+	Topic  string `json:"topic"`
+	Group  string `json:"group,omitempty"`
+	Host   string `json:"host,omitempty"`
+}
+
+// wsMessage is what the server sends. Data is always a list: statuses,
+// metrics or alerts depending on the topic.
+type wsMessage struct {
+	Topic string `json:"topic"`
+	Group string `json:"group,omitempty"`
+	Host  string `json:"host,omitempty"`
+	ID    uint64 `json:"id,omitempty"`
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// wsClient holds the subscriptions of one connection. Only the goroutine
+// running run touches it; a nil subscription means not subscribed.
+type wsClient struct {
+	h    *handler
+	conn *websocket.Conn
+
+	statuses   *hub.Subscription[[]data.ServiceStatus]
+	statusSeen uint64
+	alerts     *hub.Subscription[data.Alert]
+	metrics    *hub.Subscription[data.HardwareMetrics]
+	metricSeen uint64
+	group      string
+	host       string
+	bucket     metricBucket
+	lastTS     time.Time
+}
+
+// WebSocketHandler serves statuses, metrics and alerts over a single
+// connection, see wsCommand for how to subscribe.
+func (h *handler) WebSocketHandler(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			slog.Warn("WebSocket upgrade failed", "remote", r.RemoteAddr, "err", err)
+			return
+		}
+		slog.Info("WebSocket client connected", "remote", r.RemoteAddr)
+		defer slog.Info("WebSocket client disconnected", "remote", r.RemoteAddr)
+		telemetry.StreamClients.Inc("websocket")
+		defer telemetry.StreamClients.Dec("websocket")
+
+		c := &wsClient{h: h, conn: conn}
+		defer c.close()
+		c.run(ctx)
+	}
+}
+
+func (c *wsClient) run(ctx context.Context) {
+	commands := make(chan wsCommand)
+	readDone := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.readCommands(commands, readDone, stop)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(wsWriteTimeout))
+			return
+		case <-readDone:
+			return
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case cmd := <-commands:
+			c.handle(cmd)
+		case e, ok := <-subChan(c.statuses):
+			if !ok {
+				c.statuses = nil
+				c.send(wsMessage{Topic: "error", Error: "too slow, unsubscribed from " + topicStatuses})
+				continue
+			}
+			if e.ID > c.statusSeen {
+				c.send(wsMessage{Topic: topicStatuses, ID: e.ID, Data: e.Value})
+			}
+		case e, ok := <-subChan(c.alerts):
+			if !ok {
+				c.alerts = nil
+				c.send(wsMessage{Topic: "error", Error: "too slow, unsubscribed from " + topicAlerts})
+				continue
+			}
+			c.send(wsMessage{Topic: topicAlerts, ID: e.ID, Data: []data.Alert{e.Value}})
+		case e, ok := <-subChan(c.metrics):
+			if !ok {
+				c.metrics = nil
+				c.send(wsMessage{Topic: "error", Error: "too slow, unsubscribed from " + topicMetrics})
+				continue
+			}
+			c.onMetric(e)
+		}
+	}
+}
+
+// subChan returns the channel of s, or nil (which blocks forever in a
+// select) when there is no subscription.
+func subChan[T any](s *hub.Subscription[T]) <-chan hub.Event[T] {
+	if s == nil {
+		return nil
+	}
+	return s.C
+}
+
+// readCommands is the only reader of the connection, it hands commands over
+// to run until the connection fails or stop is closed.
+func (c *wsClient) readCommands(commands chan<- wsCommand, done chan<- struct{}, stop <-chan struct{}) {
+	defer close(done)
+	c.conn.SetReadLimit(4096)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("WebSocket read failed", "err", err)
+			}
+			return
+		}
+		var cmd wsCommand
+		if err := json.Unmarshal(msg, &cmd); err != nil {
+			cmd = wsCommand{Action: "invalid"}
+		}
+		select {
+		case commands <- cmd:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *wsClient) handle(cmd wsCommand) {
+	switch cmd.Action {
+	case "subscribe":
+		c.subscribe(cmd)
+	case "unsubscribe":
+		c.unsubscribe(cmd.Topic)
+	case "invalid":
+		c.send(wsMessage{Topic: "error", Error: "invalid JSON"})
+	default:
+		c.send(wsMessage{Topic: "error", Error: "unknown action " + cmd.Action})
+	}
+}
+
+func (c *wsClient) subscribe(cmd wsCommand) {
+	switch cmd.Topic {
+	case topicStatuses:
+		if c.statuses != nil {
+			return
+		}
+		// Events up to sub.LastID are part of the snapshot below.
+		sub, _ := c.h.statusHub.Subscribe(0)
+		c.statuses, c.statusSeen = sub, sub.LastID
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+		defer cancel()
+		statuses, err := c.h.serviceStatus.GetLatestServiceStatus(ctx)
+		if err != nil {
+			slog.Error("Failed to get health status", "err", err)
+			c.send(wsMessage{Topic: "error", Error: "failed to read service statuses"})
+			return
+		}
+		if statuses == nil {
+			statuses = []data.ServiceStatus{}
+		}
+		c.send(wsMessage{Topic: topicStatuses, ID: sub.LastID, Data: statuses})
+	case topicAlerts:
+		if c.alerts != nil {
+			return
+		}
+		c.alerts, _ = c.h.alertHub.Subscribe(0)
+	case topicMetrics:
+		group := cmd.Group
+		if group == "" {
+			group = "none"
+		}
+		host := cmd.Host
+		if host == "" {
+			host = monitor.Hostname()
+		}
+		c.unsubscribe(topicMetrics)
+		sub, _ := c.h.metricHub.Subscribe(0)
+		c.metrics, c.metricSeen, c.group, c.host = sub, sub.LastID, group, host
+		c.bucket, c.lastTS = metricBucket{}, time.Time{}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(monitor.ContextTimeoutSec)*time.Second)
+		defer cancel()
+		metrics, err := c.h.hardwareMetric.GetMetrics(ctx, host, group, time.Time{})
+		if err != nil {
+			slog.Error("Failed to get hardware metrics", "group", group, "err", err)
+			c.send(wsMessage{Topic: "error", Error: err.Error()})
+			c.unsubscribe(topicMetrics)
+			return
+		}
+		if len(metrics) > 0 {
+			c.lastTS = metrics[len(metrics)-1].Timestamp
+		} else {
+			metrics = []data.HardwareMetrics{}
+		}
+		c.send(wsMessage{Topic: topicMetrics, Group: group, Host: host, ID: sub.LastID, Data: metrics})
+	default:
+		c.send(wsMessage{Topic: "error", Error: "unknown topic " + cmd.Topic})
+	}
+}
+
+func (c *wsClient) onMetric(e hub.Event[data.HardwareMetrics]) {
+	if e.Value.Host != c.host || e.ID <= c.metricSeen || !e.Value.Timestamp.After(c.lastTS) {
+		return
+	}
+	if c.group == "none" {
+		c.lastTS = e.Value.Timestamp
+		c.send(wsMessage{Topic: topicMetrics, Group: c.group, Host: c.host, ID: e.ID, Data: []data.HardwareMetrics{e.Value}})
+		return
+	}
+	if avg, done := c.bucket.add(c.group, e.ID, e.Value); done && avg.Value.Timestamp.After(c.lastTS) {
+		c.lastTS = avg.Value.Timestamp
+		c.send(wsMessage{Topic: topicMetrics, Group: c.group, Host: c.host, ID: avg.ID, Data: []data.HardwareMetrics{avg.Value}})
+	}
+}
+
+func (c *wsClient) unsubscribe(topic string) {
+	switch topic {
+	case topicStatuses:
+		if c.statuses != nil {
+			c.statuses.Close()
+			c.statuses = nil
+		}
+	case topicAlerts:
+		if c.alerts != nil {
+			c.alerts.Close()
+			c.alerts = nil
+		}
+	case topicMetrics:
+		if c.metrics != nil {
+			c.metrics.Close()
+			c.metrics = nil
+		}
+	default:
+		c.send(wsMessage{Topic: "error", Error: "unknown topic " + topic})
+	}
+}
+
+func (c *wsClient) send(msg wsMessage) {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := c.conn.WriteJSON(msg); err != nil {
+		slog.Warn("WebSocket write failed", "topic", msg.Topic, "err", err)
+	}
+}
+
+func (c *wsClient) close() {
+	c.unsubscribe(topicStatuses)
+	c.unsubscribe(topicAlerts)
+	c.unsubscribe(topicMetrics)
+	if err := c.conn.Close(); err != nil {
+		slog.Warn("Failed to close WebSocket", "err", err)
+	}
+}
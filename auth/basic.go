@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"os"
+)
+
+// BasicAuth protects the dashboard with a single user. It is disabled
+// unless both MINATOR_DASHBOARD_USER and MINATOR_DASHBOARD_PASSWORD are set.
+type BasicAuth struct {
+	user     string
+	password string
+}
+
+func BasicAuthFromEnv() BasicAuth {
+	return BasicAuth{
+		user:     os.Getenv("MINATOR_DASHBOARD_USER"),
+		password: os.Getenv("MINATOR_DASHBOARD_PASSWORD"),
+	}
+}
+
+func (b BasicAuth) Enabled() bool {
+	return b.user != "" && b.password != ""
+}
+
+// Check reports whether r carries the configured credentials, it always
+// succeeds when basic auth is disabled.
+func (b BasicAuth) Check(r *http.Request) bool {
+	if !b.Enabled() {
+		return true
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	// Compare hashes so the comparison takes the same time whatever the
+	// length of the input.
+	userOK := subtle.ConstantTimeCompare(hash(user), hash(b.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare(hash(password), hash(b.password)) == 1
+	return userOK && passwordOK
+}
+
+func hash(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"minator/agent"
+	"minator/monitor"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runAgent(args []string) int {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	server := fs.String("server", os.Getenv("MINATOR_SERVER"), "URL of the central Minator, e.g. http://minator:18080")
+	token := fs.String("token", os.Getenv("MINATOR_TOKEN"), "API token allowed for the services of this host")
+	host := fs.String("host", monitor.Hostname(), "name this host reports as")
+	checksFile := fs.String("checks", os.Getenv("MINATOR_CHECKS_FILE"), "JSON file with the checks to run on this host")
+	bufferFile := fs.String("buffer-file", "", "keep unsent reports in this file across restarts")
+	maxBuffered := fs.Int("max-buffered", agent.DefaultMaxBuffered, "statuses and metrics kept while the server is unreachable")
+	fs.Parse(args)
+	if *server == "" || *token == "" {
+		fmt.Fprintln(os.Stderr, "usage: minator agent -server=URL -token=TOKEN [-host=NAME] [-checks=FILE] [-buffer-file=FILE]")
+		return 2
+	}
+	if *maxBuffered < 0 {
+		fmt.Fprintln(os.Stderr, "-max-buffered must not be negative")
+		return 2
+	}
+
+	// Unlike the server, an agent only runs the checks it is given.
+	var checks []monitor.CheckConfig
+	if *checksFile != "" {
+		var err error
+		if checks, err = monitor.ReadCheckConfigs(*checksFile); err != nil {
+			slog.Error("Failed to load checks", "error", err)
+			return 1
+		}
+	}
+
+	client := agent.NewClient(*server, *token, *host)
+	client.BufferFile = *bufferFile
+	client.MaxBuffered = *maxBuffered
+	if err := client.LoadBuffer(); err != nil {
+		slog.Error("Failed to load buffer", "error", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	m := monitor.NewAgentMonitor(client, checks)
+	m.Host = *host
+	slog.Info("Agent is starting", "server", *server, "host", *host, "checks", len(checks))
+	m.Run(ctx)
+	return 0
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+// Run executes the subcommand in args (os.Args without the program name)
+// and returns the process exit code.
+func Run(args []string) int {
+	switch args[0] {
+	case "token":
+		return runToken(args[1:])
+	case "heartbeat":
+		return runHeartbeat(args[1:])
+	case "agent":
+		return runAgent(args[1:])
+	case "maintenance":
+		return runMaintenance(args[1:])
+	case "help", "-h", "--help":
+		usage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage()
+		return 2
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage:
+  minator                 start the server
+  minator token create    create an API token for the push API
+  minator token list      list API tokens
+  minator token revoke    revoke an API token
+  minator heartbeat create  expect a job to report at least every interval
+  minator heartbeat list    list heartbeats and when they are due
+  minator heartbeat delete  stop expecting a job to report
+  minator agent           collect on this host and push to a central server
+  minator maintenance create  schedule a (recurring) maintenance window
+  minator maintenance silence silence alerts of services for a while
+  minator maintenance list    list current and upcoming windows and silences
+  minator maintenance delete  end a window or silence
+`)
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"minator/auth"
+	"minator/data"
+	"minator/repository"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+func runHeartbeat(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: minator heartbeat create|list|delete")
+		return 2
+	}
+	db, err := repository.InitDb()
+	if err != nil {
+		slog.Error("Failed to init DB", "error", err)
+		return 1
+	}
+	defer db.Close()
+	heartbeats := repository.NewHeartbeatRepo(db)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(repository.ContextTimeoutSec)*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("heartbeat create", flag.ExitOnError)
+		name := fs.String("name", "", "service name the job reports as")
+		interval := fs.String("interval", "", "how often the job must report, e.g. 25h or 7d")
+		status := fs.String("status", "success", "status the job reports when it went well")
+		fs.Parse(args[1:])
+		d, err := data.ParseDuration(*interval)
+		if *name == "" || err != nil {
+			fmt.Fprintln(os.Stderr, "usage: minator heartbeat create -name=NAME -interval=25h [-status=success]")
+			return 2
+		}
+		hb := data.Heartbeat{Name: *name, Interval: d, ExpectStatus: *status}
+		if errs := hb.Validate(); errs != nil {
+			for _, field := range slices.Sorted(maps.Keys(errs)) {
+				fmt.Fprintf(os.Stderr, "%s %s\n", field, errs[field])
+			}
+			return 2
+		}
+		token, hash, err := auth.NewToken()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		hb, created, err := heartbeats.UpsertHeartbeat(ctx, hb, hash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create heartbeat: %v\n", err)
+			return 1
+		}
+		if !created {
+			fmt.Printf("Updated heartbeat %s, its ping URL is unchanged\n", hb.Name)
+			return 0
+		}
+		fmt.Printf("Created heartbeat %s. Have the job call this URL, it won't be shown again:\n/api/ping/%s\n", hb.Name, token)
+	case "list":
+		list, err := heartbeats.GetHeartbeats(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list heartbeats: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tINTERVAL\tSTATUS\tLAST SEEN\tDEADLINE")
+		for _, hb := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", hb.Name, hb.Interval, hb.ExpectStatus,
+				formatTime(hb.LastSeen), hb.Deadline().Format(time.DateTime))
+		}
+		tw.Flush()
+	case "delete":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: minator heartbeat delete NAME")
+			return 2
+		}
+		if err := heartbeats.DeleteHeartbeat(ctx, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete heartbeat %s: %v\n", args[1], err)
+			return 1
+		}
+		fmt.Printf("Deleted heartbeat %s\n", args[1])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown heartbeat command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
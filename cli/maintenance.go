@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"minator/data"
+	"minator/repository"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runMaintenance(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: minator maintenance create|silence|list|delete")
+		return 2
+	}
+	db, err := repository.InitDb()
+	if err != nil {
+		slog.Error("Failed to init DB", "error", err)
+		return 1
+	}
+	defer db.Close()
+	windows := repository.NewMaintenanceRepo(db)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(repository.ContextTimeoutSec)*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "create", "silence":
+		mw, ok := parseMaintenanceFlags(args[0], args[1:])
+		if !ok {
+			return 2
+		}
+		mw, err := windows.CreateMaintenance(ctx, mw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", mw.Kind, err)
+			return 1
+		}
+		fmt.Printf("Created %s %d for %s, the server picks it up within 30s\n", mw.Kind, mw.ID, strings.Join(mw.Services, ","))
+	case "list":
+		now := time.Now()
+		list, err := windows.ListMaintenance(ctx, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list maintenance windows: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tKIND\tSERVICES\tTITLE\tNEXT\tDURATION\tREPEAT")
+		for _, mw := range list {
+			next := "-"
+			if o, ok := mw.Next(now); ok {
+				next = o.Start.Format(time.DateTime)
+				if !o.Start.After(now) {
+					next += " (active)"
+				}
+			}
+			repeat := "-"
+			if mw.Repeat > 0 {
+				repeat = mw.Repeat.String()
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", mw.ID, mw.Kind, strings.Join(mw.Services, ","),
+				mw.Title, next, mw.Duration, repeat)
+		}
+		tw.Flush()
+	case "delete":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: minator maintenance delete ID")
+			return 2
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid maintenance id %q\n", args[1])
+			return 2
+		}
+		if err := windows.DeleteMaintenance(ctx, id); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete maintenance %d: %v\n", id, err)
+			return 1
+		}
+		fmt.Printf("Deleted maintenance %d\n", id)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown maintenance command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// parseMaintenanceFlags reads a window ("create") or a silence starting now
+// ("silence") from args, printing what is wrong with them.
+func parseMaintenanceFlags(cmd string, args []string) (data.Maintenance, bool) {
+	fs := flag.NewFlagSet("maintenance "+cmd, flag.ExitOnError)
+	services := fs.String("services", "", "comma separated service names or patterns like backup-*")
+	title := fs.String("title", "", "what is going on, e.g. Forgejo upgrade")
+	duration := fs.String("duration", "", "how long each occurrence lasts, e.g. 1h")
+	start, repeat, until := new(string), new(string), new(string)
+	if cmd == "create" {
+		start = fs.String("start", "", `when it starts, RFC 3339 or "2006-01-02 15:04" in local time`)
+		repeat = fs.String("repeat", "", "repeat every, e.g. 7d")
+		until = fs.String("until", "", "stop repeating after, same format as -start")
+	}
+	fs.Parse(args)
+
+	usage := "usage: minator maintenance create -services=a,b -start=TIME -duration=1h [-repeat=7d] [-until=TIME] [-title=TITLE]"
+	mw := data.Maintenance{Kind: data.KindMaintenance, Title: *title, StartsAt: time.Now()}
+	if cmd == "silence" {
+		usage = "usage: minator maintenance silence -services=a,b -duration=2h [-title=TITLE]"
+		mw.Kind = data.KindSilence
+	}
+	if *services == "" || *duration == "" || (cmd == "create" && *start == "") {
+		fmt.Fprintln(os.Stderr, usage)
+		return mw, false
+	}
+	mw.Services = strings.Split(*services, ",")
+
+	var err error
+	if *start != "" {
+		if mw.StartsAt, err = parseLocalTime(*start); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -start: %v\n", err)
+			return mw, false
+		}
+	}
+	if mw.Duration, err = data.ParseDuration(*duration); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -duration: %v\n", err)
+		return mw, false
+	}
+	if *repeat != "" {
+		if mw.Repeat, err = data.ParseDuration(*repeat); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -repeat: %v\n", err)
+			return mw, false
+		}
+	}
+	if *until != "" {
+		t, err := parseLocalTime(*until)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -until: %v\n", err)
+			return mw, false
+		}
+		mw.Until = &t
+	}
+	if errs := mw.Validate(); errs != nil {
+		for _, field := range slices.Sorted(maps.Keys(errs)) {
+			fmt.Fprintf(os.Stderr, "%s %s\n", field, errs[field])
+		}
+		return mw, false
+	}
+	return mw, true
+}
+
+func parseLocalTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04", v, time.Local)
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"minator/auth"
+	"minator/repository"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func runToken(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: minator token create|list|revoke")
+		return 2
+	}
+	db, err := repository.InitDb()
+	if err != nil {
+		slog.Error("Failed to init DB", "error", err)
+		return 1
+	}
+	defer db.Close()
+	tokens := repository.NewAPITokenRepo(db)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(repository.ContextTimeoutSec)*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("token create", flag.ExitOnError)
+		name := fs.String("name", "", "what the token is used for, e.g. backup-script")
+		services := fs.String("services", "", "comma separated service names the token may report, * for all")
+		hosts := fs.String("hosts", "", "comma separated hosts an agent using the token may report as, * for all")
+		fs.Parse(args[1:])
+		if *name == "" || *services == "" {
+			fmt.Fprintln(os.Stderr, "usage: minator token create -name=NAME -services=a,b [-hosts=x,y]")
+			return 2
+		}
+		token, hash, err := auth.NewToken()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		var hostList []string
+		if *hosts != "" {
+			hostList = strings.Split(*hosts, ",")
+		}
+		t, err := tokens.CreateToken(ctx, *name, strings.Split(*services, ","), hostList, hash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create token: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Created token %d (%s). Store it now, it won't be shown again:\n%s\n", t.ID, t.Name, token)
+	case "list":
+		list, err := tokens.ListTokens(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to list tokens: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSERVICES\tHOSTS\tCREATED\tLAST USED\tREVOKED")
+		for _, t := range list {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Services, ","), strings.Join(t.Hosts, ","),
+				t.CreatedAt.Format(time.DateTime), formatTime(t.LastUsedAt), formatTime(t.RevokedAt))
+		}
+		tw.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: minator token revoke ID")
+			return 2
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid token id %q\n", args[1])
+			return 2
+		}
+		if err := tokens.RevokeToken(ctx, id); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to revoke token %d: %v\n", id, err)
+			return 1
+		}
+		fmt.Printf("Revoked token %d\n", id)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown token command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.DateTime)
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AgentReport is what an agent pushes to the central server: the statuses
+// of its local checks and its hardware metrics, possibly several collections
+// at once after the server was unreachable.
+type AgentReport struct {
+	Host     string            `json:"host"`
+	Statuses []ServiceStatus   `json:"statuses,omitempty"`
+	Metrics  []HardwareMetrics `json:"metrics,omitempty"`
+}
+
+// Validate returns a message per invalid field, or nil when r is valid.
+func (r *AgentReport) Validate(now time.Time) map[string]string {
+	errs := map[string]string{}
+	switch {
+	case strings.TrimSpace(r.Host) == "":
+		errs["host"] = "is required"
+	case len(r.Host) > MaxNameLength:
+		errs["host"] = fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	case HasControlChars(r.Host):
+		errs["host"] = "must not contain control characters"
+	}
+	for i, s := range r.Statuses {
+		field := func(name string) string { return fmt.Sprintf("statuses[%d].%s", i, name) }
+		switch {
+		case strings.TrimSpace(s.Name) == "":
+			errs[field("name")] = "is required"
+		case len(s.Name) > MaxNameLength:
+			errs[field("name")] = fmt.Sprintf("must be at most %d characters", MaxNameLength)
+		case HasControlChars(s.Name):
+			errs[field("name")] = "must not contain control characters"
+		}
+		if !slices.Contains(KnownStatuses, s.Status) {
+			errs[field("status")] = "must be one of " + strings.Join(KnownStatuses, ", ")
+		}
+		if len(s.Detail) > MaxDetailLength {
+			errs[field("detail")] = fmt.Sprintf("must be at most %d characters", MaxDetailLength)
+		}
+		if msg := validTimestamp(s.Timestamp, now); msg != "" {
+			errs[field("timestamp")] = msg
+		}
+	}
+	for i, m := range r.Metrics {
+		if msg := validTimestamp(m.Timestamp, now); msg != "" {
+			errs[fmt.Sprintf("metrics[%d].timestamp", i)] = msg
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validTimestamp(t, now time.Time) string {
+	switch {
+	case t.IsZero():
+		return "is required"
+	case t.After(now.Add(MaxClockSkew)):
+		return "must not be in the future"
+	}
+	return ""
+}
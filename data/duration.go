@@ -0,0 +1,20 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration accepts Go durations (30s, 5m, 1h30m) as well as whole days
+// (1d, 7d), which time.ParseDuration does not know about.
+func ParseDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,61 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxIncidentBodyLength caps the body of incidents and their updates.
+const MaxIncidentBodyLength = 10000
+
+// Incident is a note posted on the public status page to tell users about
+// an outage, followed by updates until it is resolved.
+type Incident struct {
+	ID         int64            `json:"id"`
+	Title      string           `json:"title"`
+	Body       string           `json:"body"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ResolvedAt *time.Time       `json:"resolved_at,omitempty"`
+	Updates    []IncidentUpdate `json:"updates"`
+}
+
+// IncidentUpdate is a follow-up on an incident, oldest first.
+type IncidentUpdate struct {
+	ID        int64     `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate returns a message per invalid field, or nil when i is valid.
+func (i *Incident) Validate() map[string]string {
+	errs := map[string]string{}
+	switch {
+	case strings.TrimSpace(i.Title) == "":
+		errs["title"] = "is required"
+	case len(i.Title) > MaxNameLength:
+		errs["title"] = fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	}
+	if len(i.Body) > MaxIncidentBodyLength {
+		errs["body"] = fmt.Sprintf("must be at most %d characters", MaxIncidentBodyLength)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Validate returns a message per invalid field, or nil when u is valid.
+func (u *IncidentUpdate) Validate() map[string]string {
+	errs := map[string]string{}
+	switch {
+	case strings.TrimSpace(u.Body) == "":
+		errs["body"] = "is required"
+	case len(u.Body) > MaxIncidentBodyLength:
+		errs["body"] = fmt.Sprintf("must be at most %d characters", MaxIncidentBodyLength)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JobRun is one execution of a job such as a backup, from start to finish.
+type JobRun struct {
+	ID         string     `json:"id"`
+	Job        string     `json:"job"`
+	Status     string     `json:"status"` // "inprogress", "success" or "failed"
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	// Bytes is how much data the run processed so far, SizeBytes the size
+	// of what it produced (e.g. the backup archive).
+	Bytes     *int64    `json:"bytes,omitempty"`
+	SizeBytes *int64    `json:"size_bytes,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Steps     []JobStep `json:"steps"`
+}
+
+// JobStep is the sub-status of one part of a run, e.g. one database of a
+// backup.
+type JobStep struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (r *JobRun) Finished() bool {
+	return r.FinishedAt != nil
+}
+
+// Duration returns how long the run took, or has been running so far.
+func (r *JobRun) Duration(now time.Time) time.Duration {
+	if r.FinishedAt != nil {
+		return r.FinishedAt.Sub(r.StartedAt)
+	}
+	return now.Sub(r.StartedAt)
+}
+
+// SetStep adds step or replaces the one with the same name.
+func (r *JobRun) SetStep(step JobStep) {
+	for i := range r.Steps {
+		if r.Steps[i].Name == step.Name {
+			r.Steps[i] = step
+			return
+		}
+	}
+	r.Steps = append(r.Steps, step)
+}
+
+// ToHealthStatus summarises the run as a status of the job, so runs show
+// up on the dashboard and count for heartbeats and alerts like any push.
+func (r *JobRun) ToHealthStatus(now time.Time) ServiceStatus {
+	detail := fmt.Sprintf("run %s", r.ID)
+	switch {
+	case r.Finished():
+		detail = fmt.Sprintf("run %s finished in %s", r.ID, r.Duration(now).Round(time.Second))
+		if r.ExitCode != nil {
+			detail += fmt.Sprintf(", exit code %d", *r.ExitCode)
+		}
+	case len(r.Steps) > 0:
+		last := r.Steps[len(r.Steps)-1]
+		detail = fmt.Sprintf("run %s, %s: %s", r.ID, last.Name, last.Status)
+	}
+	if r.Message != "" {
+		detail += ", " + r.Message
+	}
+	return ServiceStatus{Name: r.Job, Status: r.Status, Detail: detail, Timestamp: now}
+}
+
+func (r JobRun) MarshalJSON() ([]byte, error) {
+	type alias JobRun
+	steps := r.Steps
+	if steps == nil {
+		steps = []JobStep{}
+	}
+	a := alias(r)
+	a.Steps = steps
+	return json.Marshal(struct {
+		alias
+		DurationSec float64 `json:"duration_seconds"`
+	}{a, r.Duration(time.Now()).Seconds()})
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StatusMaintenance is recorded instead of the checked status while a
+// service is in a maintenance window.
+const StatusMaintenance = "maintenance"
+
+// Kinds of Maintenance.
+const (
+	// KindMaintenance records matching services as under maintenance,
+	// suppresses their alerts and leaves the window out of uptime.
+	KindMaintenance = "maintenance"
+	// KindSilence only suppresses alerts.
+	KindSilence = "silence"
+)
+
+// Maintenance is a window during which the services matching Services are
+// expected to misbehave. A window with a Repeat recurs every Repeat from
+// StartsAt, until Until if set.
+type Maintenance struct {
+	ID    int64  `json:"id"`
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	// Services are service names or patterns like "backup-*", "*" matching
+	// every service.
+	Services  []string      `json:"services"`
+	StartsAt  time.Time     `json:"starts_at"`
+	Duration  time.Duration `json:"-"`
+	Repeat    time.Duration `json:"-"`
+	Until     *time.Time    `json:"until,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// MinMaintenanceDuration is the shortest window, and the shortest period of
+// a recurring one. Shorter ones make no sense against checks running every
+// minute and would make Occurrences loop over far too many windows.
+const MinMaintenanceDuration = time.Minute
+
+// Interval is a time range, End excluded.
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (mw Maintenance) MarshalJSON() ([]byte, error) {
+	type alias Maintenance
+	repeat := ""
+	if mw.Repeat > 0 {
+		repeat = mw.Repeat.String()
+	}
+	return json.Marshal(struct {
+		alias
+		Duration string `json:"duration"`
+		Repeat   string `json:"repeat,omitempty"`
+	}{alias(mw), mw.Duration.String(), repeat})
+}
+
+// Matches reports whether the window applies to service name.
+func (mw *Maintenance) Matches(name string) bool {
+	for _, pattern := range mw.Services {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Occurrences returns the occurrences of the window overlapping [from, to).
+func (mw *Maintenance) Occurrences(from, to time.Time) []Interval {
+	if mw.Repeat <= 0 {
+		end := mw.StartsAt.Add(mw.Duration)
+		if mw.StartsAt.Before(to) && end.After(from) {
+			return []Interval{{mw.StartsAt, end}}
+		}
+		return nil
+	}
+	var occurrences []Interval
+	// Skip straight to the last occurrence starting before from.
+	n := int64(0)
+	if from.After(mw.StartsAt) {
+		n = int64(from.Sub(mw.StartsAt) / mw.Repeat)
+	}
+	for start := mw.StartsAt.Add(time.Duration(n) * mw.Repeat); start.Before(to); start = start.Add(mw.Repeat) {
+		if mw.Until != nil && start.After(*mw.Until) {
+			break
+		}
+		if end := start.Add(mw.Duration); end.After(from) {
+			occurrences = append(occurrences, Interval{start, end})
+		}
+	}
+	return occurrences
+}
+
+// ActiveAt returns the occurrence of the window covering t, if any.
+func (mw *Maintenance) ActiveAt(t time.Time) (Interval, bool) {
+	if o := mw.Occurrences(t, t.Add(time.Nanosecond)); len(o) > 0 {
+		return o[0], true
+	}
+	return Interval{}, false
+}
+
+// Next returns the occurrence covering t, or else the first one after t.
+func (mw *Maintenance) Next(t time.Time) (Interval, bool) {
+	// No occurrence starts later than one period after t (or StartsAt).
+	to := t
+	if mw.StartsAt.After(to) {
+		to = mw.StartsAt
+	}
+	if o := mw.Occurrences(t, to.Add(mw.Repeat+time.Nanosecond)); len(o) > 0 {
+		return o[0], true
+	}
+	return Interval{}, false
+}
+
+// Validate returns a message per invalid field, or nil when mw is valid.
+func (mw *Maintenance) Validate() map[string]string {
+	errs := map[string]string{}
+	if !slices.Contains([]string{KindMaintenance, KindSilence}, mw.Kind) {
+		errs["kind"] = fmt.Sprintf("must be %s or %s", KindMaintenance, KindSilence)
+	}
+	if len(mw.Title) > MaxNameLength {
+		errs["title"] = fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	}
+	if len(mw.Services) == 0 {
+		errs["services"] = "is required"
+	}
+	for _, pattern := range mw.Services {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" || len(pattern) > MaxNameLength {
+			errs["services"] = fmt.Sprintf("%q is not a valid service name or pattern", pattern)
+			break
+		}
+	}
+	if mw.StartsAt.IsZero() {
+		errs["starts_at"] = "is required"
+	}
+	if mw.Duration < MinMaintenanceDuration {
+		errs["duration"] = fmt.Sprintf("must be at least %s", MinMaintenanceDuration)
+	}
+	if mw.Repeat < 0 || (mw.Repeat > 0 && mw.Repeat < max(mw.Duration, MinMaintenanceDuration)) {
+		errs["repeat"] = fmt.Sprintf("must be at least the duration and %s", MinMaintenanceDuration)
+	}
+	if mw.Until != nil && mw.Until.Before(mw.StartsAt) {
+		errs["until"] = "must be after starts_at"
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sample is a single value of a named host metric, e.g. load1 or
+// net_rx_bytes_per_second{interface="eth0"}. New metrics only need a new
+// name, no schema change.
+type Sample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Key identifies the series a sample belongs to, e.g.
+// `net_rx_bytes_per_second{interface="eth0"}`.
+func (s Sample) Key() string {
+	return SeriesKey(s.Name, s.Labels)
+}
+
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k + `="` + labels[k] + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// SampleSeries is one series returned by a sample query.
+type SampleSeries struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []SamplePoint     `json:"points"`
+}
+
+type SamplePoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
@@ -3,40 +3,253 @@ package data
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type ServiceStatus struct {
+	ID int64 `json:"id,omitempty"`
+	// Host is the machine that ran the check, empty for statuses pushed
+	// through the API.
+	Host      string    `json:"host,omitempty"`
 	Name      string    `json:"name"`
 	Status    string    `json:"status"`
 	Detail    string    `json:"detail"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// HardwareMetrics is one collection of host metrics. A nil value means the
+// metric could not be collected, it is stored and sent as null.
 type HardwareMetrics struct {
-	CPUPercent  float64   `json:"cpu_percent"`
-	RAMPercent  float64   `json:"ram_percent"`
-	DiskPercent float64   `json:"disk_percent"`
-	Timestamp   time.Time `json:"timestamp"`
+	Host       string   `json:"host,omitempty"`
+	CPUPercent *float64 `json:"cpu_percent"`
+	RAMPercent *float64 `json:"ram_percent"`
+	// DiskPercent is the usage of the root file system (or the first
+	// monitored mount), Disks has every monitored mount.
+	DiskPercent *float64    `json:"disk_percent"`
+	Disks       []DiskUsage `json:"disks,omitempty"`
+	// Samples holds everything else: load, swap, network, disk I/O and
+	// temperatures.
+	Samples   []Sample  `json:"samples,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type DiskUsage struct {
+	Mountpoint        string  `json:"mountpoint"`
+	Device            string  `json:"device,omitempty"`
+	Fstype            string  `json:"fstype,omitempty"`
+	TotalBytes        uint64  `json:"total_bytes"`
+	UsedBytes         uint64  `json:"used_bytes"`
+	UsedPercent       float64 `json:"used_percent"`
+	InodesUsedPercent float64 `json:"inodes_used_percent"`
+}
+
+// DiskPoint is the usage of one mount at a point in time, as returned by
+// metric queries.
+type DiskPoint struct {
+	Timestamp         time.Time `json:"timestamp"`
+	UsedPercent       float64   `json:"used_percent"`
+	InodesUsedPercent float64   `json:"inodes_used_percent"`
+	UsedBytes         float64   `json:"used_bytes"`
+}
+
+// Alert is raised when a service turns unhealthy and resolved once it
+// recovers. Every change is published with the state it led to.
+type Alert struct {
+	ID        int64     `json:"id,omitempty"`
+	Name      string    `json:"name"`
+	State     string    `json:"state"` // "firing", "acknowledged" or "resolved"
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail"`
+	Timestamp time.Time `json:"timestamp"`
+	// FiredAt is when the alert started firing, Timestamp is the time of
+	// this event.
+	FiredAt time.Time  `json:"fired_at"`
+	AckedAt *time.Time `json:"acked_at,omitempty"`
+	AckedBy string     `json:"acked_by,omitempty"`
+	// Escalation is the number of escalation steps notified so far.
+	Escalation     int        `json:"escalation"`
+	LastNotifiedAt *time.Time `json:"last_notified_at,omitempty"`
+	// ResolvedAt and ResolvedStatus are set on alerts read back from
+	// history once the service recovered, Status and Detail remain the
+	// ones that fired the alert.
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	ResolvedStatus string     `json:"resolved_status,omitempty"`
+}
+
+// APIToken grants access to the push API for the services listed in
+// Services, "*" meaning all of them. Agents also need their host listed in
+// Hosts. Only a hash of the token is stored.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Services   []string   `json:"services"`
+	Hosts      []string   `json:"hosts"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Allows reports whether the token may report the status of service.
+func (t *APIToken) Allows(service string) bool {
+	for _, s := range t.Services {
+		if s == "*" || s == service {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsHost reports whether an agent using the token may report as host.
+func (t *APIToken) AllowsHost(host string) bool {
+	for _, h := range t.Hosts {
+		if h == "*" || h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusOverdue is recorded for a heartbeat that didn't report in time.
+const StatusOverdue = "overdue"
+
+// StatusImpacted is recorded for a check that failed while one of the checks
+// it depends on was down.
+const StatusImpacted = "impacted"
+
+// Heartbeat declares that Name must report ExpectStatus at least every
+// Interval, otherwise it is marked overdue.
+type Heartbeat struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"-"`
+	ExpectStatus string        `json:"expect_status"`
+	CreatedAt    time.Time     `json:"created_at"`
+	// LastSeen is the last time ExpectStatus was reported, if ever.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Deadline returns when the next report is due.
+func (hb *Heartbeat) Deadline() time.Time {
+	if hb.LastSeen != nil {
+		return hb.LastSeen.Add(hb.Interval)
+	}
+	return hb.CreatedAt.Add(hb.Interval)
+}
+
+func (hb Heartbeat) MarshalJSON() ([]byte, error) {
+	type alias Heartbeat
+	return json.Marshal(struct {
+		alias
+		Interval string    `json:"interval"`
+		Deadline time.Time `json:"deadline"`
+	}{alias(hb), hb.Interval.String(), hb.Deadline()})
+}
+
+// MinHeartbeatInterval keeps heartbeats above the monitor's check interval.
+const MinHeartbeatInterval = time.Minute
+
+// Validate returns a message per invalid field, or nil when hb is valid.
+func (hb *Heartbeat) Validate() map[string]string {
+	errs := map[string]string{}
+	switch {
+	case strings.TrimSpace(hb.Name) == "":
+		errs["name"] = "is required"
+	case len(hb.Name) > MaxNameLength:
+		errs["name"] = fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	case HasControlChars(hb.Name):
+		errs["name"] = "must not contain control characters"
+	}
+	if hb.Interval < MinHeartbeatInterval {
+		errs["interval"] = fmt.Sprintf("must be at least %s", MinHeartbeatInterval)
+	}
+	if !slices.Contains(KnownStatuses, hb.ExpectStatus) {
+		errs["expect_status"] = "must be one of " + strings.Join(KnownStatuses, ", ")
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
 }
 
 type ServiceRequest struct {
 	Name    string         `json:"name"`
 	Status  string         `json:"status"`
 	Details map[string]any `json:"details"`
+	// Timestamp lets scripts report retroactively, it defaults to the time
+	// the request is received.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
 }
 
-func (s *ServiceRequest) ToHealthStatus(lastCheck time.Time) ServiceStatus {
+// Limits applied to pushed statuses, mostly to keep them within the columns
+// of service_status.
+const (
+	MaxNameLength    = 255
+	MaxDetailLength  = 4096
+	MaxDetailEntries = 50
+	MaxClockSkew     = 5 * time.Minute
+)
+
+// HasControlChars reports whether s contains control characters such as
+// line breaks. Names end up in mail headers and log lines, where those
+// would let the sender forge content.
+func HasControlChars(s string) bool {
+	return strings.ContainsFunc(s, unicode.IsControl)
+}
+
+// KnownStatuses are the statuses the dashboard knows how to display.
+var KnownStatuses = []string{"healthy", "unhealthy", "degraded", "down", "critical", "success", "failed", "inprogress"}
+
+// Validate returns a message per invalid field, or nil when s is valid.
+func (s *ServiceRequest) Validate(now time.Time) map[string]string {
+	errs := map[string]string{}
+	switch {
+	case strings.TrimSpace(s.Name) == "":
+		errs["name"] = "is required"
+	case len(s.Name) > MaxNameLength:
+		errs["name"] = fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	case HasControlChars(s.Name):
+		errs["name"] = "must not contain control characters"
+	}
+	if !slices.Contains(KnownStatuses, s.Status) {
+		errs["status"] = "must be one of " + strings.Join(KnownStatuses, ", ")
+	}
+	if len(s.Details) > MaxDetailEntries {
+		errs["details"] = fmt.Sprintf("must have at most %d entries", MaxDetailEntries)
+	} else if len(s.detail()) > MaxDetailLength {
+		errs["details"] = fmt.Sprintf("must be at most %d characters once formatted", MaxDetailLength)
+	}
+	if s.Timestamp != nil && s.Timestamp.After(now.Add(MaxClockSkew)) {
+		errs["timestamp"] = "must not be in the future"
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// detail formats Details as "key: value" pairs sorted by key.
+func (s *ServiceRequest) detail() string {
 	msg := make([]string, 0, len(s.Details))
-	for key, val := range s.Details {
-		msg = append(msg, fmt.Sprintf("%s: %s", key, val))
+	for _, key := range slices.Sorted(maps.Keys(s.Details)) {
+		msg = append(msg, fmt.Sprintf("%s: %v", key, s.Details[key]))
+	}
+	return strings.Join(msg, ", ")
+}
+
+// ToHealthStatus converts s to a status, lastCheck is used unless s carries
+// its own timestamp.
+func (s *ServiceRequest) ToHealthStatus(lastCheck time.Time) ServiceStatus {
+	if s.Timestamp != nil {
+		lastCheck = *s.Timestamp
 	}
 	return ServiceStatus{
 		Name:      s.Name,
 		Status:    s.Status,
 		Timestamp: lastCheck,
-		Detail:    strings.Join(msg, ", "),
+		Detail:    s.detail(),
 	}
 }
 
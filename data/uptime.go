@@ -0,0 +1,132 @@
+package data
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// UptimeMaxGap is how long a single status sample is trusted when no newer
+// one follows it. The monitor checks every 30s, so anything longer than this
+// means we simply don't know what happened.
+const UptimeMaxGap = 5 * time.Minute
+
+type Uptime struct {
+	Name          string    `json:"name"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	UptimePercent *float64  `json:"uptime_percent"`
+	Outages       int       `json:"outages"`
+	UptimeSec     float64   `json:"uptime_seconds"`
+	DowntimeSec   float64   `json:"downtime_seconds"`
+	UnknownSec    float64   `json:"unknown_seconds"`
+	// MaintenanceSec is time spent in maintenance windows, it is left out
+	// of the percentage like unknown time.
+	MaintenanceSec float64 `json:"maintenance_seconds"`
+	MTTRSec        float64 `json:"mttr_seconds"`
+	MTBFSec        float64 `json:"mtbf_seconds"`
+}
+
+// IsDown reports whether status means the service is unavailable.
+func IsDown(status string) bool {
+	switch strings.ToLower(status) {
+	case "unhealthy", "down", "critical", "failed", StatusOverdue, StatusImpacted:
+		return true
+	}
+	return false
+}
+
+// ComputeUptime attributes the time between consecutive samples to the
+// earlier one. statuses must be sorted by timestamp ascending and may start
+// with a sample older than from, which then defines the state at from.
+// Time not covered by any sample (or further than maxGap from the previous
+// one) is counted as unknown and left out of the percentage, and so is time
+// recorded as maintenance or within one of the maintenance intervals.
+func ComputeUptime(name string, statuses []ServiceStatus, from, to time.Time, maxGap time.Duration, maintenance []Interval) Uptime {
+	u := Uptime{Name: name, From: from, To: to}
+	maintenance = mergeIntervals(maintenance)
+	var up, down, maint time.Duration
+	inOutage := false
+	for i, s := range statuses {
+		start := s.Timestamp
+		if start.Before(from) {
+			start = from
+		}
+		end := to
+		if i+1 < len(statuses) && statuses[i+1].Timestamp.Before(end) {
+			end = statuses[i+1].Timestamp
+		}
+		if limit := s.Timestamp.Add(maxGap); limit.Before(end) {
+			end = limit
+		}
+		if !end.After(start) {
+			continue
+		}
+		// An outage interrupted by maintenance is still the same outage.
+		if s.Status == StatusMaintenance {
+			maint += end.Sub(start)
+			continue
+		}
+		excluded := overlap(start, end, maintenance)
+		maint += excluded
+		if IsDown(s.Status) {
+			if !inOutage && end.Sub(start) > excluded {
+				u.Outages++
+				inOutage = true
+			}
+			down += end.Sub(start) - excluded
+		} else {
+			inOutage = false
+			up += end.Sub(start) - excluded
+		}
+	}
+
+	u.UptimeSec = up.Seconds()
+	u.DowntimeSec = down.Seconds()
+	u.MaintenanceSec = maint.Seconds()
+	u.UnknownSec = (to.Sub(from) - up - down - maint).Seconds()
+	if known := up + down; known > 0 {
+		pct := float64(up) / float64(known) * 100
+		u.UptimePercent = &pct
+	}
+	if u.Outages > 0 {
+		u.MTTRSec = down.Seconds() / float64(u.Outages)
+		u.MTBFSec = up.Seconds() / float64(u.Outages)
+	}
+	return u
+}
+
+// mergeIntervals sorts intervals and merges the overlapping ones.
+func mergeIntervals(intervals []Interval) []Interval {
+	sorted := slices.Clone(intervals)
+	slices.SortFunc(sorted, func(a, b Interval) int { return a.Start.Compare(b.Start) })
+	var merged []Interval
+	for _, iv := range sorted {
+		if n := len(merged); n > 0 && !iv.Start.After(merged[n-1].End) {
+			if iv.End.After(merged[n-1].End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// overlap returns how much of [start, end) the merged intervals cover.
+func overlap(start, end time.Time, merged []Interval) time.Duration {
+	var d time.Duration
+	for _, iv := range merged {
+		s, e := iv.Start, iv.End
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			d += e.Sub(s)
+		}
+	}
+	return d
+}
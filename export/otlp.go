@@ -0,0 +1,338 @@
+// Package export pushes collected metrics and check results to external
+// time series stores, next to what is stored in Postgres.
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"minator/data"
+	"minator/hub"
+	"minator/telemetry"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	flushInterval = 10 * time.Second
+	maxBatch      = 1000
+	// maxQueued bounds what is kept while the receiver is down, the oldest
+	// points are dropped beyond it.
+	maxQueued   = 50000
+	maxBackoff  = 5 * time.Minute
+	sendTimeout = 30 * time.Second
+)
+
+// OTLPExporter follows published statuses and hardware metrics and sends
+// them as OTLP/HTTP JSON to Endpoint/v1/metrics, in batches. Batches that
+// fail are retried with exponential backoff.
+type OTLPExporter struct {
+	Endpoint   string
+	Headers    map[string]string
+	HTTPClient *http.Client
+
+	statusHub *hub.Hub[[]data.ServiceStatus]
+	metricHub *hub.Hub[data.HardwareMetrics]
+
+	// queue and backoff are only touched by the goroutine running Run.
+	queue   []point
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// point is a single gauge value, grouped into OTLP resources by host.
+type point struct {
+	host  string
+	name  string
+	unit  string
+	attrs map[string]string
+	ts    time.Time
+	value float64
+}
+
+// OTLPFromEnv configures the exporter from MINATOR_OTLP_ENDPOINT (e.g.
+// http://localhost:4318) and MINATOR_OTLP_HEADERS ("key=value,..."). It
+// returns false when no endpoint is set.
+func OTLPFromEnv(statusHub *hub.Hub[[]data.ServiceStatus], metricHub *hub.Hub[data.HardwareMetrics]) (*OTLPExporter, bool) {
+	endpoint := os.Getenv("MINATOR_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return nil, false
+	}
+	headers := map[string]string{}
+	for _, kv := range strings.Split(os.Getenv("MINATOR_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return &OTLPExporter{
+		Endpoint:   strings.TrimSuffix(endpoint, "/"),
+		Headers:    headers,
+		HTTPClient: &http.Client{Timeout: sendTimeout},
+		statusHub:  statusHub,
+		metricHub:  metricHub,
+	}, true
+}
+
+func (e *OTLPExporter) Run(ctx context.Context) {
+	slog.Info("Exporting to OTLP", "endpoint", e.Endpoint)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		statuses, _ := e.statusHub.Subscribe(0)
+		metrics, _ := e.metricHub.Subscribe(0)
+		e.follow(ctx, ticker.C, statuses, metrics)
+		statuses.Close()
+		metrics.Close()
+	}
+	// Last chance for what is still queued.
+	e.flush(context.WithoutCancel(ctx))
+	slog.Info("Stop exporting due to context cancellation.")
+}
+
+// follow queues published values until ctx is done or a hub drops us.
+func (e *OTLPExporter) follow(ctx context.Context, tick <-chan time.Time,
+	statuses *hub.Subscription[[]data.ServiceStatus], metrics *hub.Subscription[data.HardwareMetrics]) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			e.flush(ctx)
+		case ev, ok := <-statuses.C:
+			if !ok {
+				slog.Warn("OTLP exporter fell behind on statuses, resubscribing")
+				return
+			}
+			e.enqueue(statusPoints(ev.Value)...)
+		case ev, ok := <-metrics.C:
+			if !ok {
+				slog.Warn("OTLP exporter fell behind on metrics, resubscribing")
+				return
+			}
+			e.enqueue(metricPoints(ev.Value)...)
+		}
+	}
+}
+
+func (e *OTLPExporter) enqueue(points ...point) {
+	e.queue = append(e.queue, points...)
+	if over := len(e.queue) - maxQueued; over > 0 {
+		slog.Warn("OTLP export queue is full, dropping oldest points", "dropped", over)
+		telemetry.ExportedPoints.Add("dropped", float64(over))
+		e.queue = e.queue[over:]
+	}
+}
+
+// flush sends queued points in batches, unless a previous failure asked to
+// wait before retrying.
+func (e *OTLPExporter) flush(ctx context.Context) {
+	if time.Now().Before(e.retryAt) {
+		return
+	}
+	for len(e.queue) > 0 {
+		batch := e.queue[:min(len(e.queue), maxBatch)]
+		retry, err := e.send(ctx, batch)
+		if err != nil && retry {
+			e.backoff = min(maxBackoff, max(flushInterval, 2*e.backoff))
+			e.retryAt = time.Now().Add(e.backoff)
+			slog.Warn("Failed to export to OTLP, will retry", "points", len(e.queue), "retryIn", e.backoff, "error", err)
+			return
+		}
+		if err != nil {
+			slog.Error("OTLP receiver rejected batch, dropping it", "points", len(batch), "error", err)
+			telemetry.ExportedPoints.Add("dropped", float64(len(batch)))
+		} else {
+			telemetry.ExportedPoints.Add("sent", float64(len(batch)))
+		}
+		e.queue = e.queue[len(batch):]
+		e.backoff = 0
+	}
+}
+
+// send posts batch and reports whether a failure is worth retrying.
+func (e *OTLPExporter) send(ctx context.Context, batch []point) (bool, error) {
+	body, err := json.Marshal(encode(batch))
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+"/v1/metrics", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("receiver answered %s: %s", resp.Status, msg)
+	default:
+		return false, fmt.Errorf("receiver answered %s: %s", resp.Status, msg)
+	}
+}
+
+func statusPoints(statuses []data.ServiceStatus) []point {
+	points := make([]point, 0, len(statuses))
+	for _, s := range statuses {
+		up := 1.0
+		if data.IsDown(s.Status) {
+			up = 0
+		}
+		points = append(points, point{
+			host:  s.Host,
+			name:  "minator.service.up",
+			attrs: map[string]string{"service": s.Name, "status": s.Status},
+			ts:    s.Timestamp,
+			value: up,
+		})
+	}
+	return points
+}
+
+func metricPoints(m data.HardwareMetrics) []point {
+	var points []point
+	add := func(name, unit string, attrs map[string]string, v float64) {
+		points = append(points, point{host: m.Host, name: name, unit: unit, attrs: attrs, ts: m.Timestamp, value: v})
+	}
+	for name, v := range map[string]*float64{
+		"minator.cpu.percent":  m.CPUPercent,
+		"minator.ram.percent":  m.RAMPercent,
+		"minator.disk.percent": m.DiskPercent,
+	} {
+		if v != nil {
+			add(name, "%", nil, *v)
+		}
+	}
+	for _, d := range m.Disks {
+		attrs := map[string]string{"mountpoint": d.Mountpoint}
+		add("minator.disk.used_percent", "%", attrs, d.UsedPercent)
+		add("minator.disk.inodes_used_percent", "%", attrs, d.InodesUsedPercent)
+		add("minator.disk.used_bytes", "By", attrs, float64(d.UsedBytes))
+	}
+	for _, s := range m.Samples {
+		add("minator.host."+s.Name, "", s.Labels, s.Value)
+	}
+	return points
+}
+
+// The types below are the subset of the OTLP JSON encoding we need, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string    `json:"name"`
+	Unit  string    `json:"unit,omitempty"`
+	Gauge otlpGauge `json:"gauge"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// encode groups points by host into resources and by name into metrics.
+func encode(points []point) otlpRequest {
+	byHost := map[string]map[string]*otlpMetric{}
+	var hosts []string
+	for _, p := range points {
+		metrics, ok := byHost[p.host]
+		if !ok {
+			metrics = map[string]*otlpMetric{}
+			byHost[p.host] = metrics
+			hosts = append(hosts, p.host)
+		}
+		m, ok := metrics[p.name]
+		if !ok {
+			m = &otlpMetric{Name: p.name, Unit: p.unit}
+			metrics[p.name] = m
+		}
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpDataPoint{
+			Attributes:   attributes(p.attrs),
+			TimeUnixNano: strconv.FormatInt(p.ts.UnixNano(), 10),
+			AsDouble:     p.value,
+		})
+	}
+
+	var req otlpRequest
+	for _, host := range hosts {
+		resource := otlpResource{Attributes: []otlpAttribute{{"service.name", otlpValue{"minator"}}}}
+		if host != "" {
+			resource.Attributes = append(resource.Attributes, otlpAttribute{"host.name", otlpValue{host}})
+		}
+		names := make([]string, 0, len(byHost[host]))
+		for name := range byHost[host] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		scope := otlpScopeMetrics{Scope: otlpScope{Name: "minator"}}
+		for _, name := range names {
+			scope.Metrics = append(scope.Metrics, *byHost[host][name])
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, otlpResourceMetrics{Resource: resource, ScopeMetrics: []otlpScopeMetrics{scope}})
+	}
+	return req
+}
+
+func attributes(m map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpAttribute{k, otlpValue{m[k]}})
+	}
+	return attrs
+}
@@ -0,0 +1,177 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is an OTLP endpoint answering with the status codes in codes,
+// one per request, and 200 once they are used up.
+type receiver struct {
+	mu      sync.Mutex
+	codes   []int
+	batches []int
+	headers []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpRequest
+	if r.URL.Path != "/v1/metrics" || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	n := 0
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				n += len(m.Gauge.DataPoints)
+			}
+		}
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.batches = append(rc.batches, n)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	code := http.StatusOK
+	if len(rc.codes) > 0 {
+		code, rc.codes = rc.codes[0], rc.codes[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func (rc *receiver) sent() []int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]int(nil), rc.batches...)
+}
+
+func newTestExporter(t *testing.T, rc *receiver) *OTLPExporter {
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	return &OTLPExporter{
+		Endpoint:   srv.URL,
+		Headers:    map[string]string{"Authorization": "Bearer secret"},
+		HTTPClient: srv.Client(),
+	}
+}
+
+func testPoints(n int) []point {
+	points := make([]point, n)
+	ts := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for i := range points {
+		points[i] = point{host: "nas", name: "minator.cpu.percent", unit: "%", ts: ts, value: float64(i)}
+	}
+	return points
+}
+
+func TestFlushSendsBatches(t *testing.T) {
+	rc := &receiver{}
+	e := newTestExporter(t, rc)
+	e.enqueue(testPoints(2*maxBatch + 5)...)
+
+	e.flush(context.Background())
+
+	if got, want := rc.sent(), []int{maxBatch, maxBatch, 5}; !slices.Equal(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+	if len(e.queue) != 0 {
+		t.Errorf("queue has %d points left, want 0", len(e.queue))
+	}
+	for _, h := range rc.headers {
+		if h.Get("Authorization") != "Bearer secret" || h.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v, want the configured ones and JSON", h)
+		}
+	}
+}
+
+func TestFlushRetriesWithBackoff(t *testing.T) {
+	for _, code := range []int{http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		t.Run(http.StatusText(code), func(t *testing.T) {
+			rc := &receiver{codes: []int{code, code}}
+			e := newTestExporter(t, rc)
+			e.enqueue(testPoints(maxBatch + 1)...)
+
+			e.flush(context.Background())
+			if len(e.queue) != maxBatch+1 {
+				t.Fatalf("queue has %d points, want the failed batch kept", len(e.queue))
+			}
+			if e.backoff != flushInterval || !e.retryAt.After(time.Now()) {
+				t.Fatalf("backoff = %v, retryAt = %v, want %v from now", e.backoff, e.retryAt, flushInterval)
+			}
+
+			// Nothing is sent before retryAt.
+			e.flush(context.Background())
+			if got := rc.sent(); len(got) != 1 {
+				t.Fatalf("sent %d requests before retryAt, want 1", len(got))
+			}
+
+			e.retryAt = time.Time{}
+			e.flush(context.Background())
+			if e.backoff != 2*flushInterval {
+				t.Fatalf("backoff = %v after a second failure, want %v", e.backoff, 2*flushInterval)
+			}
+
+			e.retryAt = time.Time{}
+			e.flush(context.Background())
+			if got, want := rc.sent(), []int{maxBatch, maxBatch, maxBatch, 1}; !slices.Equal(got, want) {
+				t.Errorf("batches = %v, want %v", got, want)
+			}
+			if len(e.queue) != 0 || e.backoff != 0 {
+				t.Errorf("queue = %d, backoff = %v after success, want 0, 0", len(e.queue), e.backoff)
+			}
+		})
+	}
+}
+
+func TestFlushBackoffIsCapped(t *testing.T) {
+	rc := &receiver{codes: []int{500, 500, 500, 500, 500, 500, 500, 500, 500, 500}}
+	e := newTestExporter(t, rc)
+	e.enqueue(testPoints(1)...)
+	for range rc.codes {
+		e.retryAt = time.Time{}
+		e.flush(context.Background())
+	}
+	if e.backoff != maxBackoff {
+		t.Errorf("backoff = %v, want %v", e.backoff, maxBackoff)
+	}
+}
+
+func TestFlushDropsRejectedBatches(t *testing.T) {
+	rc := &receiver{codes: []int{http.StatusBadRequest}}
+	e := newTestExporter(t, rc)
+	e.enqueue(testPoints(maxBatch + 1)...)
+
+	e.flush(context.Background())
+
+	if got, want := rc.sent(), []int{maxBatch, 1}; !slices.Equal(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+	if len(e.queue) != 0 {
+		t.Errorf("queue has %d points left, want the rejected batch dropped", len(e.queue))
+	}
+	if e.backoff != 0 || !e.retryAt.IsZero() {
+		t.Errorf("backoff = %v, retryAt = %v, want no retry", e.backoff, e.retryAt)
+	}
+}
+
+func TestEnqueueDropsOldest(t *testing.T) {
+	e := &OTLPExporter{}
+	e.enqueue(testPoints(maxQueued)...)
+	e.enqueue(testPoints(10)...)
+
+	if len(e.queue) != maxQueued {
+		t.Fatalf("queue has %d points, want %d", len(e.queue), maxQueued)
+	}
+	if e.queue[0].value != 10 {
+		t.Errorf("oldest queued point = %v, want 10", e.queue[0].value)
+	}
+	if last := e.queue[len(e.queue)-1].value; last != 9 {
+		t.Errorf("newest queued point = %v, want 9", last)
+	}
+}
@@ -3,6 +3,7 @@ module minator
 go 1.24.2
 
 require (
+	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.9
 	github.com/shirou/gopsutil/v4 v4.25.8
 )
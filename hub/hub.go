@@ -0,0 +1,126 @@
+package hub
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Hub fans published values out to every subscriber. It keeps the last few
+// events around so new subscribers can catch up on what they missed.
+//
+// Publishing never blocks: a subscriber whose buffer is full is considered
+// too slow and gets dropped, its channel is closed so the consumer can
+// notice and reconnect.
+type Hub[T any] struct {
+	name   string
+	buffer int
+	replay int
+
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event[T]
+	subs    map[*Subscription[T]]struct{}
+}
+
+// Event is a published value along with its ID. IDs increase by one with
+// every publish and are seeded from the clock, so IDs handed out by a
+// restarted process are still greater than the ones before.
+type Event[T any] struct {
+	ID    uint64
+	Value T
+}
+
+type Subscription[T any] struct {
+	// C receives the replayed events followed by everything published
+	// after subscribing. It is closed when the subscription ends.
+	C <-chan Event[T]
+	// LastID is the ID of the newest event published before subscribing.
+	LastID uint64
+
+	c   chan Event[T]
+	hub *Hub[T]
+}
+
+// New creates a hub keeping the last replay events, with room for buffer
+// pending events per subscriber.
+func New[T any](name string, replay, buffer int) *Hub[T] {
+	return &Hub[T]{
+		name:   name,
+		buffer: buffer,
+		replay: replay,
+		lastID: uint64(time.Now().UnixNano()),
+		subs:   make(map[*Subscription[T]]struct{}),
+	}
+}
+
+func (h *Hub[T]) Publish(v T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	e := Event[T]{ID: h.lastID, Value: v}
+	if h.replay > 0 {
+		if len(h.history) == h.replay {
+			h.history = append(h.history[:0], h.history[1:]...)
+		}
+		h.history = append(h.history, e)
+	}
+	for s := range h.subs {
+		select {
+		case s.c <- e:
+		default:
+			slog.Warn("Dropping slow subscriber", "hub", h.name)
+			h.remove(s)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. Buffered events newer than lastID
+// are already queued on its channel when this returns. The returned bool
+// reports whether those cover everything published after lastID; it is
+// false when lastID is zero, unknown or too old for the replay buffer, in
+// which case the caller has to catch up some other way.
+func (h *Hub[T]) Subscribe(lastID uint64) (*Subscription[T], bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Without history, only a subscriber that is already up to date has
+	// missed nothing: after a restart the history is empty and lastID is
+	// reseeded from the clock, so older IDs tell nothing about what was
+	// published in between.
+	complete := lastID != 0 && lastID <= h.lastID
+	if len(h.history) == 0 {
+		complete = lastID == h.lastID
+	} else if h.history[0].ID > lastID+1 {
+		complete = false
+	}
+	c := make(chan Event[T], h.replay+h.buffer)
+	for _, e := range h.history {
+		if e.ID > lastID {
+			c <- e
+		}
+	}
+	s := &Subscription[T]{C: c, LastID: h.lastID, c: c, hub: h}
+	h.subs[s] = struct{}{}
+	return s, complete
+}
+
+// Subscribers returns the number of active subscribers.
+func (h *Hub[T]) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+func (h *Hub[T]) remove(s *Subscription[T]) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
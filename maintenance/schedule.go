@@ -0,0 +1,121 @@
+// Package maintenance applies maintenance windows and silences to what the
+// monitor and the push API record.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"minator/repository"
+	"sync"
+	"time"
+)
+
+// refreshAfter is how long windows are cached, changes made from the CLI
+// are picked up within that time.
+const refreshAfter = 30 * time.Second
+
+// Schedule caches the current maintenance windows.
+type Schedule struct {
+	repo repository.MaintenanceRepo
+
+	mu       sync.Mutex
+	windows  []data.Maintenance
+	loadedAt time.Time
+}
+
+func NewSchedule(repo repository.MaintenanceRepo) *Schedule {
+	return &Schedule{repo: repo}
+}
+
+// Windows returns the windows that are active or still to come, reading
+// them again when the cache is stale.
+func (s *Schedule) Windows(ctx context.Context) ([]data.Maintenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.loadedAt) < refreshAfter {
+		return s.windows, nil
+	}
+	windows, err := s.repo.ListMaintenance(ctx, time.Now())
+	if err != nil {
+		// Keep using what we had rather than dropping every window.
+		return s.windows, err
+	}
+	s.windows, s.loadedAt = windows, time.Now()
+	return windows, nil
+}
+
+// Invalidate makes the next call to Windows read them again, e.g. after
+// one was created or deleted.
+func (s *Schedule) Invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// cached returns the windows without touching the database.
+func (s *Schedule) cached() []data.Maintenance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.windows
+}
+
+// Apply records statuses of services in a maintenance window as
+// maintenance, keeping what the check reported in the detail.
+func (s *Schedule) Apply(ctx context.Context, statuses []data.ServiceStatus) {
+	windows, err := s.Windows(ctx)
+	if err != nil {
+		slog.Warn("Failed to read maintenance windows", "error", err)
+	}
+	for i, st := range statuses {
+		mw, ok := find(windows, data.KindMaintenance, st.Name, st.Timestamp)
+		if !ok || st.Status == data.StatusMaintenance {
+			continue
+		}
+		title := mw.Title
+		if title == "" {
+			title = "Maintenance"
+		}
+		statuses[i].Status = data.StatusMaintenance
+		statuses[i].Detail = fmt.Sprintf("%s, check reported %s: %s", title, st.Status, st.Detail)
+	}
+}
+
+// Silenced reports whether alerts for service name are suppressed at t,
+// by a silence or a maintenance window.
+func (s *Schedule) Silenced(name string, t time.Time) bool {
+	windows := s.cached()
+	_, silenced := find(windows, data.KindSilence, name, t)
+	_, maintained := find(windows, data.KindMaintenance, name, t)
+	return silenced || maintained
+}
+
+// Excluded returns the maintenance intervals of service name between from
+// and to, which don't count towards its uptime.
+func (s *Schedule) Excluded(ctx context.Context, name string, from, to time.Time) ([]data.Interval, error) {
+	// The cache only has current windows, past ones come from the database.
+	windows, err := s.repo.ListMaintenance(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	var intervals []data.Interval
+	for _, mw := range windows {
+		if mw.Kind == data.KindMaintenance && mw.Matches(name) {
+			intervals = append(intervals, mw.Occurrences(from, to)...)
+		}
+	}
+	return intervals, nil
+}
+
+func find(windows []data.Maintenance, kind, name string, t time.Time) (data.Maintenance, bool) {
+	for _, mw := range windows {
+		if mw.Kind != kind || !mw.Matches(name) {
+			continue
+		}
+		if _, ok := mw.ActiveAt(t); ok {
+			return mw, true
+		}
+	}
+	return data.Maintenance{}, false
+}
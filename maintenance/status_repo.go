@@ -0,0 +1,26 @@
+package maintenance
+
+import (
+	"context"
+	"minator/data"
+	"minator/repository"
+)
+
+// statusRepo applies the schedule to statuses before they are stored, so
+// checks, pushed statuses and agent reports are all covered.
+type statusRepo struct {
+	repository.ServiceStatusRepo
+	schedule *Schedule
+}
+
+// WrapStatusRepo returns repo recording statuses of services in a
+// maintenance window as maintenance. Like the ID, the status is updated in
+// place so what gets published afterwards matches what was stored.
+func WrapStatusRepo(repo repository.ServiceStatusRepo, schedule *Schedule) repository.ServiceStatusRepo {
+	return &statusRepo{ServiceStatusRepo: repo, schedule: schedule}
+}
+
+func (r *statusRepo) InsertServiceStatus(ctx context.Context, statuses []data.ServiceStatus) error {
+	r.schedule.Apply(ctx, statuses)
+	return r.ServiceStatusRepo.InsertServiceStatus(ctx, statuses)
+}
@@ -9,12 +9,22 @@ import (
 	"syscall"
 	"time"
 
+	"minator/alert"
 	"minator/api"
+	"minator/cli"
+	"minator/data"
+	"minator/export"
+	"minator/hub"
+	"minator/maintenance"
 	"minator/monitor"
 	"minator/repository"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	// Structured shutdown with signal handling
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -31,18 +41,111 @@ func main() {
 		}
 	}()
 
-	ss := repository.NewServiceStatusRepo(db)
+	// Statuses are stored as "maintenance" while a window is in progress,
+	// whichever way they come in.
+	mr := repository.NewMaintenanceRepo(db)
+	schedule := maintenance.NewSchedule(mr)
+	ss := maintenance.WrapStatusRepo(repository.NewServiceStatusRepo(db), schedule)
 	hm := repository.NewHardwareMetricsRepo(db)
-	h := api.NewHandler(ss, hm)
+	hb := repository.NewHeartbeatRepo(db)
+	if err := hm.ClaimUnassigned(ctx, monitor.Hostname()); err != nil {
+		slog.Warn("Failed to assign existing metrics to this host", "error", err)
+	}
+
+	// New statuses and metrics are published once and fanned out to every
+	// connected dashboard, instead of each of them polling the database.
+	statusHub := hub.New[[]data.ServiceStatus]("service-statuses", 10, 16)
+	metricHub := hub.New[data.HardwareMetrics]("hardware-metrics", 100, 16)
+	// alertHub is only fed by the alert manager below and backs the
+	// "alerts" WebSocket topic.
+	alertHub := hub.New[data.Alert]("alerts", 10, 16)
+
+	checks, err := monitor.LoadCheckConfigs()
+	if err != nil {
+		slog.Error("Failed to load checks", "error", err)
+		os.Exit(1)
+	}
+	monitor := monitor.NewMonitor(ss, hm, hb, statusHub, metricHub, checks)
+
+	// Raise alerts when services go down
+	channels := map[string]alert.Notifier{"log": alert.LogNotifier{}}
+	if email, ok := alert.EmailNotifierFromEnv(); ok {
+		channels["email"] = email
+	}
+	if webhook, ok := alert.WebhookNotifierFromEnv(); ok {
+		channels["webhook"] = webhook
+	}
+	policies, err := alert.PoliciesFromEnv(channels)
+	if err != nil {
+		slog.Error("Failed to load alert policies", "error", err)
+		os.Exit(1)
+	}
+	ar := repository.NewAlertRepo(db)
+	alerts := alert.NewManager(ar, statusHub, alertHub, channels)
+	alerts.Silencer = schedule
+	alerts.Policies = policies
+
+	h := api.NewHandler(api.Deps{
+		ServiceStatus:  ss,
+		HardwareMetric: hm,
+		APIToken:       repository.NewAPITokenRepo(db),
+		Heartbeat:      hb,
+		JobRun:         repository.NewJobRunRepo(db),
+		Maintenance:    mr,
+		Schedule:       schedule,
+		Alert:          ar,
+		Alerts:         alerts,
+		Incident:       repository.NewIncidentRepo(db),
+		StatusHub:      statusHub,
+		MetricHub:      metricHub,
+		AlertHub:       alertHub,
+		Dependencies:   monitor.Dependencies(),
+	})
 
 	// Set up HTTP server
 	fs := http.FileServer(http.Dir("templates/static"))
 	mux := http.NewServeMux()
 	mux.Handle("/templates/static/", http.StripPrefix("/templates/static", fs))
-	mux.HandleFunc("GET /status", h.StatusPageHandler)
+	// The push API authenticates with tokens, everything else belongs to
+	// the dashboard and is covered by its (optional) basic auth.
 	mux.HandleFunc("POST /api/service/status", h.ServiceStatusHandler())
-	mux.HandleFunc("GET /api/stream/hardware-metrics", h.StreamHardwareMetrics(ctx))
-	mux.HandleFunc("GET /api/stream/service-statuses", h.StreamServiceStatuses(ctx))
+	mux.HandleFunc("POST /api/agent/report", h.AgentReportHandler)
+	mux.HandleFunc("PUT /api/heartbeats/{name}", h.PutHeartbeatHandler)
+	mux.HandleFunc("DELETE /api/heartbeats/{name}", h.DeleteHeartbeatHandler)
+	mux.HandleFunc("POST /api/maintenance", h.CreateMaintenanceHandler)
+	mux.HandleFunc("DELETE /api/maintenance/{id}", h.DeleteMaintenanceHandler)
+	mux.HandleFunc("POST /api/incidents", h.CreateIncidentHandler)
+	mux.HandleFunc("POST /api/incidents/{id}/updates", h.AddIncidentUpdateHandler)
+	mux.HandleFunc("DELETE /api/incidents/{id}", h.DeleteIncidentHandler)
+	mux.HandleFunc("POST /api/jobs/{job}/runs", h.StartRunHandler)
+	mux.HandleFunc("POST /api/jobs/{job}/runs/{id}/progress", h.RunProgressHandler)
+	mux.HandleFunc("POST /api/jobs/{job}/runs/{id}/finish", h.FinishRunHandler)
+	mux.HandleFunc("GET /api/ping/{token}", h.PingHandler)
+	mux.HandleFunc("POST /api/ping/{token}", h.PingHandler)
+	// The public status page is meant to be seen by anyone.
+	mux.HandleFunc("GET /public", h.PublicPageHandler)
+	mux.HandleFunc("GET /api/public/status", h.PublicStatusHandler)
+	mux.HandleFunc("GET /api/public/incidents", h.PublicIncidentsHandler)
+	mux.HandleFunc("GET /status", h.RequireDashboardAuth(h.StatusPageHandler))
+	mux.HandleFunc("GET /timeline", h.RequireDashboardAuth(h.TimelinePageHandler))
+	mux.HandleFunc("GET /api/services", h.RequireDashboardAuth(h.ServicesHandler))
+	mux.HandleFunc("GET /api/services/dependencies", h.RequireDashboardAuth(h.DependenciesHandler))
+	mux.HandleFunc("GET /api/services/transitions", h.RequireDashboardAuth(h.TransitionsHandler))
+	mux.HandleFunc("GET /api/services/{name}/history", h.RequireDashboardAuth(h.ServiceHistoryHandler))
+	mux.HandleFunc("GET /api/services/{name}/uptime", h.RequireDashboardAuth(h.ServiceUptimeHandler))
+	mux.HandleFunc("GET /api/heartbeats", h.RequireDashboardAuth(h.HeartbeatsHandler))
+	mux.HandleFunc("GET /api/maintenance", h.RequireDashboardAuth(h.MaintenanceHandler))
+	mux.HandleFunc("GET /api/alerts", h.RequireDashboardAuth(h.AlertsHandler))
+	mux.HandleFunc("POST /api/alerts/{id}/ack", h.RequireDashboardAuth(h.AckAlertHandler))
+	mux.HandleFunc("GET /api/jobs/runs", h.RequireDashboardAuth(h.JobRunsHandler))
+	mux.HandleFunc("GET /api/metrics/hardware", h.RequireDashboardAuth(h.HardwareMetricsHandler))
+	mux.HandleFunc("GET /api/metrics/disks", h.RequireDashboardAuth(h.DiskMetricsHandler))
+	mux.HandleFunc("GET /api/metrics/host", h.RequireDashboardAuth(h.HostMetricsHandler))
+	mux.HandleFunc("GET /api/hosts", h.RequireDashboardAuth(h.HostsHandler))
+	mux.HandleFunc("GET /api/stream/hardware-metrics", h.RequireDashboardAuth(h.StreamHardwareMetrics(ctx)))
+	mux.HandleFunc("GET /api/stream/service-statuses", h.RequireDashboardAuth(h.StreamServiceStatuses(ctx)))
+	mux.HandleFunc("GET /api/ws", h.RequireDashboardAuth(h.WebSocketHandler(ctx)))
+	mux.HandleFunc("GET /metrics", h.RequireDashboardAuth(h.PrometheusHandler))
 
 	port := getPort()
 	server := &http.Server{
@@ -53,11 +156,17 @@ func main() {
 	}
 
 	// Start periodic health checks
-	monitor := monitor.NewMonitor()
 	monitorCtx, monitorCancel := context.WithCancel(ctx)
 	defer monitorCancel()
 	go monitor.Run(monitorCtx)
 
+	go alerts.Run(monitorCtx)
+
+	// Optionally push everything to an external time series store
+	if exporter, ok := export.OTLPFromEnv(statusHub, metricHub); ok {
+		go exporter.Run(monitorCtx)
+	}
+
 	// Start HTTP server in a goroutine
 	go func() {
 		slog.Info("Server is starting", "port", port)
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"fmt"
+	"minator/data"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupFilesCheck inspects backup artifacts on disk. Path is a directory
+// or a glob, the check goes unhealthy when the newest matching file is
+// older than MaxAge or smaller than MinSize, or when the number of retained
+// files is outside [MinCount, MaxCount]. Zero values disable a limit.
+type BackupFilesCheck struct {
+	Path     string
+	MaxAge   time.Duration
+	MinSize  int64
+	MinCount int
+	MaxCount int
+}
+
+func newBackupFilesCheck(c CheckConfig) (*BackupFilesCheck, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	bc := &BackupFilesCheck{Path: c.Path, MinSize: c.MinSize, MinCount: c.MinCount, MaxCount: c.MaxCount}
+	if c.MaxAge != "" {
+		d, err := data.ParseDuration(c.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max_age: %v", err)
+		}
+		bc.MaxAge = d
+	}
+	if bc.MaxCount > 0 && bc.MinCount > bc.MaxCount {
+		return nil, fmt.Errorf("min_count is greater than max_count")
+	}
+	return bc, nil
+}
+
+func (c *BackupFilesCheck) run() data.ServiceStatus {
+	return c.check(time.Now())
+}
+
+func (c *BackupFilesCheck) check(now time.Time) data.ServiceStatus {
+	pattern := c.Path
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("Invalid backup path %s: %v", c.Path, err)}
+	}
+
+	var (
+		newest     os.FileInfo
+		newestPath string
+		count      int
+	)
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		count++
+		if newest == nil || info.ModTime().After(newest.ModTime()) {
+			newest, newestPath = info, path
+		}
+	}
+	if newest == nil {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("No backup files found in %s", c.Path)}
+	}
+
+	age := now.Sub(newest.ModTime())
+	detail := fmt.Sprintf("Newest %s is %s old (%s), %d backups",
+		filepath.Base(newestPath), age.Round(time.Minute), formatBytes(newest.Size()), count)
+	var problems []string
+	if c.MaxAge > 0 && age > c.MaxAge {
+		problems = append(problems, fmt.Sprintf("older than %s", c.MaxAge))
+	}
+	if c.MinSize > 0 && newest.Size() < c.MinSize {
+		problems = append(problems, fmt.Sprintf("smaller than %s", formatBytes(c.MinSize)))
+	}
+	if c.MinCount > 0 && count < c.MinCount {
+		problems = append(problems, fmt.Sprintf("fewer than %d backups", c.MinCount))
+	}
+	if c.MaxCount > 0 && count > c.MaxCount {
+		problems = append(problems, fmt.Sprintf("more than %d backups", c.MaxCount))
+	}
+	if len(problems) > 0 {
+		return data.ServiceStatus{Status: "unhealthy", Detail: detail + ": " + strings.Join(problems, ", ")}
+	}
+	return data.ServiceStatus{Status: "healthy", Detail: detail}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
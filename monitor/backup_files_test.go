@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeBackup creates a file of size bytes in dir, last modified at mtime.
+func writeBackup(t *testing.T, dir, name string, size int, mtime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupFilesCheck(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	dir := t.TempDir()
+	writeBackup(t, dir, "backup-1.tar.gz", 2048, now.Add(-50*time.Hour))
+	writeBackup(t, dir, "backup-2.tar.gz", 2048, now.Add(-26*time.Hour))
+	writeBackup(t, dir, "backup-3.tar.gz", 1024, now.Add(-2*time.Hour))
+	writeBackup(t, dir, "notes.txt", 10, now.Add(-100*time.Hour))
+	if err := os.Mkdir(filepath.Join(dir, "old"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		check      BackupFilesCheck
+		wantStatus string
+		wantDetail string
+	}{
+		{
+			name:       "no limits",
+			check:      BackupFilesCheck{Path: dir},
+			wantStatus: "healthy",
+			wantDetail: "Newest backup-3.tar.gz is 2h0m0s old (1.0 KiB), 4 backups",
+		},
+		{
+			name:       "glob",
+			check:      BackupFilesCheck{Path: filepath.Join(dir, "*.tar.gz"), MaxAge: 3 * time.Hour, MinSize: 1024, MinCount: 3, MaxCount: 3},
+			wantStatus: "healthy",
+			wantDetail: "Newest backup-3.tar.gz is 2h0m0s old (1.0 KiB), 3 backups",
+		},
+		{
+			name:       "too old",
+			check:      BackupFilesCheck{Path: dir, MaxAge: time.Hour},
+			wantStatus: "unhealthy",
+			wantDetail: "older than 1h0m0s",
+		},
+		{
+			name:       "too small",
+			check:      BackupFilesCheck{Path: dir, MinSize: 2048},
+			wantStatus: "unhealthy",
+			wantDetail: "smaller than 2.0 KiB",
+		},
+		{
+			name:       "too few",
+			check:      BackupFilesCheck{Path: filepath.Join(dir, "*.tar.gz"), MinCount: 4},
+			wantStatus: "unhealthy",
+			wantDetail: "fewer than 4 backups",
+		},
+		{
+			name:       "too many",
+			check:      BackupFilesCheck{Path: filepath.Join(dir, "*.tar.gz"), MaxCount: 2},
+			wantStatus: "unhealthy",
+			wantDetail: "more than 2 backups",
+		},
+		{
+			name:       "every problem",
+			check:      BackupFilesCheck{Path: dir, MaxAge: time.Hour, MinSize: 2048, MaxCount: 1},
+			wantStatus: "unhealthy",
+			wantDetail: "older than 1h0m0s, smaller than 2.0 KiB, more than 1 backups",
+		},
+		{
+			name:       "nothing matches",
+			check:      BackupFilesCheck{Path: filepath.Join(dir, "*.zip")},
+			wantStatus: "unhealthy",
+			wantDetail: "No backup files found",
+		},
+		{
+			name:       "missing directory",
+			check:      BackupFilesCheck{Path: filepath.Join(dir, "missing")},
+			wantStatus: "unhealthy",
+			wantDetail: "No backup files found",
+		},
+		{
+			name:       "invalid glob",
+			check:      BackupFilesCheck{Path: filepath.Join(dir, "[")},
+			wantStatus: "unhealthy",
+			wantDetail: "Invalid backup path",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.check.check(now)
+			if s.Status != tt.wantStatus || !strings.Contains(s.Detail, tt.wantDetail) {
+				t.Errorf("check() = %s (%s), want %s containing %q", s.Status, s.Detail, tt.wantStatus, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1024:          "1.0 KiB",
+		1536:          "1.5 KiB",
+		5 << 20:       "5.0 MiB",
+		3 << 30:       "3.0 GiB",
+		(1 << 40) * 2: "2.0 TiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"os"
+)
+
+// CheckConfig describes a single check. Which fields matter depends on
+// Type:
+//   - "http": URL must answer 200
+//   - "podman": the healthcheck of Container must pass
+//   - "backup_files": see BackupFilesCheck
+//   - "prometheus": Expr must hold for the metrics scraped from URL, see
+//     PrometheusCheck
+type CheckConfig struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+	Container string `json:"container,omitempty"`
+	// DependsOn lists checks this one needs, while one of them is down this
+	// one is recorded as impacted instead of failed.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// backup_files
+	Path     string `json:"path,omitempty"`
+	MaxAge   string `json:"max_age,omitempty"`
+	MinSize  int64  `json:"min_size,omitempty"`
+	MinCount int    `json:"min_count,omitempty"`
+	MaxCount int    `json:"max_count,omitempty"`
+
+	// prometheus, e.g. `pg_up{instance="db"} == 1`
+	Expr string `json:"expr,omitempty"`
+}
+
+// check is a configured check, ready to run.
+type check struct {
+	name string
+	run  func() data.ServiceStatus
+}
+
+// defaultChecks are used unless MINATOR_CHECKS_FILE points to a JSON file
+// with a list of CheckConfig.
+var defaultChecks = []CheckConfig{
+	{Name: "forgejo", Type: "http", URL: "http://localhost:3000/api/healthz"},
+	{Name: "privatebin", Type: "http", URL: "http://localhost:8080/"},
+	{Name: "postgresql", Type: "podman", Container: "hl-postgres"},
+	// {Name: "nextcloud", Type: "http", URL: "http://localhost/nextcloud/status.php"},
+}
+
+// LoadCheckConfigs reads the checks from MINATOR_CHECKS_FILE, or returns
+// the defaults when it isn't set.
+func LoadCheckConfigs() ([]CheckConfig, error) {
+	path := os.Getenv("MINATOR_CHECKS_FILE")
+	if path == "" {
+		return defaultChecks, nil
+	}
+	return ReadCheckConfigs(path)
+}
+
+// ReadCheckConfigs reads a JSON file with a list of CheckConfig.
+func ReadCheckConfigs(path string) ([]CheckConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checks file: %v", err)
+	}
+	var configs []CheckConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse checks file %s: %v", path, err)
+	}
+	return configs, nil
+}
+
+// buildChecks turns configs into checks, skipping (and logging) the
+// invalid ones so a typo doesn't take all monitoring down.
+func (m *Monitor) buildChecks(configs []CheckConfig) []check {
+	checks := make([]check, 0, len(configs))
+	for _, c := range configs {
+		run, err := m.checkFunc(c)
+		if err != nil {
+			slog.Error("Skipping invalid check", "name", c.Name, "type", c.Type, "error", err)
+			continue
+		}
+		checks = append(checks, check{name: c.Name, run: run})
+	}
+	return checks
+}
+
+func (m *Monitor) checkFunc(c CheckConfig) (func() data.ServiceStatus, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	switch c.Type {
+	case "http":
+		if c.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		return func() data.ServiceStatus { return m.checkHttpHealth(c.URL) }, nil
+	case "podman":
+		if c.Container == "" {
+			return nil, fmt.Errorf("container is required")
+		}
+		return func() data.ServiceStatus { return m.CheckPodmanHealth(c.Container) }, nil
+	case "backup_files":
+		bc, err := newBackupFilesCheck(c)
+		if err != nil {
+			return nil, err
+		}
+		return bc.run, nil
+	case "prometheus":
+		pc, err := newPrometheusCheck(c)
+		if err != nil {
+			return nil, err
+		}
+		return func() data.ServiceStatus { return pc.run(m.HTTPClient) }, nil
+	default:
+		return nil, fmt.Errorf("unknown check type %q", c.Type)
+	}
+}
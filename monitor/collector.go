@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/mem"
+)
+
+// Collector reads one kind of hardware metric into m. A collector that fails
+// leaves its fields unset, so they are stored as missing rather than as
+// zero, and never keeps the other collectors from running.
+type Collector interface {
+	Name() string
+	Collect(m *data.HardwareMetrics) error
+}
+
+// defaultCollectors returns the collectors used by NewMonitor.
+func defaultCollectors(mounts []string) []Collector {
+	collectors := []Collector{
+		newCPUCollector(),
+		memCollector{},
+		diskCollector{mounts: mounts},
+		newHostCollector(),
+	}
+	if c := newContainerCollector(); c != nil {
+		collectors = append(collectors, c)
+	}
+	if c := newProcessCollector(); c != nil {
+		collectors = append(collectors, c)
+	}
+	return collectors
+}
+
+// runCollectors fills a HardwareMetrics from every collector. A panicking
+// collector is treated like a failing one.
+func runCollectors(collectors []Collector, now time.Time) data.HardwareMetrics {
+	metrics := data.HardwareMetrics{Timestamp: now}
+	for _, c := range collectors {
+		if err := safeCollect(c, &metrics); err != nil {
+			slog.Error("Failed to collect hardware metric", "collector", c.Name(), "error", err)
+		}
+	}
+	return metrics
+}
+
+func safeCollect(c Collector, m *data.HardwareMetrics) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Collect(m)
+}
+
+var errNotPrimed = errors.New("no previous reading yet")
+
+// cpuCollector measures CPU usage between two of its own readings rather
+// than relying on cpu.Percent(0, ...), whose first result is meaningless and
+// which shares its state with every other caller.
+type cpuCollector struct {
+	times func() ([]cpu.TimesStat, error)
+	prev  *cpu.TimesStat
+}
+
+func newCPUCollector() *cpuCollector {
+	c := &cpuCollector{times: func() ([]cpu.TimesStat, error) { return cpu.Times(false) }}
+	// Prime with a first reading so the first collection has a baseline.
+	if err := c.read(nil); err != nil && !errors.Is(err, errNotPrimed) {
+		slog.Warn("Failed to prime CPU collector", "error", err)
+	}
+	return c
+}
+
+func (c *cpuCollector) Name() string { return "cpu" }
+
+func (c *cpuCollector) Collect(m *data.HardwareMetrics) error {
+	return c.read(m)
+}
+
+func (c *cpuCollector) read(m *data.HardwareMetrics) error {
+	times, err := c.times()
+	if err != nil {
+		return err
+	}
+	if len(times) == 0 {
+		return errors.New("no CPU times reported")
+	}
+	prev := c.prev
+	c.prev = &times[0]
+	if prev == nil {
+		return errNotPrimed
+	}
+	pct, ok := busyPercent(*prev, times[0])
+	if !ok {
+		// Too soon after the previous reading, keep that one as baseline.
+		c.prev = prev
+		return errors.New("CPU times did not advance")
+	}
+	if m != nil {
+		m.CPUPercent = &pct
+	}
+	return nil
+}
+
+// busyPercent mirrors gopsutil's computation of cpu.Percent between two
+// readings.
+func busyPercent(t1, t2 cpu.TimesStat) (float64, bool) {
+	all := func(t cpu.TimesStat) (float64, float64) {
+		total := t.Total()
+		if runtime.GOOS == "linux" {
+			total -= t.Guest + t.GuestNice
+		}
+		return total, total - t.Idle - t.Iowait
+	}
+	t1All, t1Busy := all(t1)
+	t2All, t2Busy := all(t2)
+	if t2All <= t1All {
+		return 0, false
+	}
+	if t2Busy <= t1Busy {
+		return 0, true
+	}
+	return min(100, (t2Busy-t1Busy)/(t2All-t1All)*100), true
+}
+
+type memCollector struct{}
+
+func (memCollector) Name() string { return "memory" }
+
+func (memCollector) Collect(m *data.HardwareMetrics) error {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return err
+	}
+	if vm == nil {
+		return errors.New("no memory statistics reported")
+	}
+	m.RAMPercent = &vm.UsedPercent
+	return nil
+}
+
+type diskCollector struct {
+	mounts []string
+}
+
+func (diskCollector) Name() string { return "disk" }
+
+func (c diskCollector) Collect(m *data.HardwareMetrics) error {
+	m.Disks = collectDiskUsage(c.mounts)
+	m.DiskPercent = primaryDiskPercent(m.Disks)
+	if len(m.Disks) == 0 {
+		return errors.New("no mount could be read")
+	}
+	return nil
+}
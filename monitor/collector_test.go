@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"errors"
+	"minator/data"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+)
+
+// fakeCollector runs collect, or fails with err when collect is nil.
+type fakeCollector struct {
+	name    string
+	collect func(m *data.HardwareMetrics)
+	err     error
+	calls   int
+}
+
+func (f *fakeCollector) Name() string { return f.name }
+
+func (f *fakeCollector) Collect(m *data.HardwareMetrics) error {
+	f.calls++
+	if f.collect == nil {
+		return f.err
+	}
+	f.collect(m)
+	return nil
+}
+
+func TestRunCollectors(t *testing.T) {
+	ram := 42.0
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	failing := &fakeCollector{name: "cpu", err: errors.New("boom")}
+	panicking := &fakeCollector{name: "disk", collect: func(*data.HardwareMetrics) { panic("oops") }}
+	working := &fakeCollector{name: "memory", collect: func(m *data.HardwareMetrics) { m.RAMPercent = &ram }}
+
+	m := runCollectors([]Collector{failing, panicking, working}, now)
+
+	if !m.Timestamp.Equal(now) {
+		t.Errorf("Timestamp = %v, want %v", m.Timestamp, now)
+	}
+	if m.CPUPercent != nil {
+		t.Errorf("CPUPercent = %v, want nil for a failing collector", *m.CPUPercent)
+	}
+	if m.DiskPercent != nil {
+		t.Errorf("DiskPercent = %v, want nil for a panicking collector", *m.DiskPercent)
+	}
+	if m.RAMPercent == nil || *m.RAMPercent != ram {
+		t.Errorf("RAMPercent = %v, want %v", m.RAMPercent, ram)
+	}
+	for _, c := range []*fakeCollector{failing, panicking, working} {
+		if c.calls != 1 {
+			t.Errorf("collector %s called %d times, want 1", c.name, c.calls)
+		}
+	}
+}
+
+func TestSafeCollectRecoversPanic(t *testing.T) {
+	c := &fakeCollector{name: "panic", collect: func(*data.HardwareMetrics) { panic("oops") }}
+	if err := safeCollect(c, &data.HardwareMetrics{}); err == nil || err.Error() != "panic: oops" {
+		t.Errorf("safeCollect() = %v, want panic: oops", err)
+	}
+}
+
+// fakeTimes returns readings one after the other.
+func fakeTimes(readings ...cpu.TimesStat) func() ([]cpu.TimesStat, error) {
+	return func() ([]cpu.TimesStat, error) {
+		if len(readings) == 0 {
+			return nil, errors.New("no more readings")
+		}
+		r := readings[0]
+		readings = readings[1:]
+		return []cpu.TimesStat{r}, nil
+	}
+}
+
+func TestCPUCollector(t *testing.T) {
+	t.Run("unprimed", func(t *testing.T) {
+		c := &cpuCollector{times: fakeTimes(cpu.TimesStat{User: 10, Idle: 90})}
+		var m data.HardwareMetrics
+		if err := c.Collect(&m); !errors.Is(err, errNotPrimed) {
+			t.Errorf("Collect() = %v, want %v", err, errNotPrimed)
+		}
+		if m.CPUPercent != nil {
+			t.Errorf("CPUPercent = %v, want nil", *m.CPUPercent)
+		}
+	})
+
+	t.Run("primed", func(t *testing.T) {
+		c := &cpuCollector{times: fakeTimes(
+			cpu.TimesStat{User: 10, Idle: 90},
+			cpu.TimesStat{User: 40, Idle: 160},
+		)}
+		if err := c.read(nil); !errors.Is(err, errNotPrimed) {
+			t.Fatalf("priming read() = %v, want %v", err, errNotPrimed)
+		}
+		var m data.HardwareMetrics
+		if err := c.Collect(&m); err != nil {
+			t.Fatalf("Collect() = %v", err)
+		}
+		if m.CPUPercent == nil || *m.CPUPercent != 30 {
+			t.Errorf("CPUPercent = %v, want 30", m.CPUPercent)
+		}
+	})
+
+	t.Run("keeps baseline when times did not advance", func(t *testing.T) {
+		c := &cpuCollector{times: fakeTimes(
+			cpu.TimesStat{User: 10, Idle: 90},
+			cpu.TimesStat{User: 10, Idle: 90},
+			cpu.TimesStat{User: 60, Idle: 140},
+		)}
+		c.read(nil)
+		var m data.HardwareMetrics
+		if err := c.Collect(&m); err == nil {
+			t.Fatal("Collect() = nil, want an error when times did not advance")
+		}
+		if m.CPUPercent != nil {
+			t.Errorf("CPUPercent = %v, want nil", *m.CPUPercent)
+		}
+		if err := c.Collect(&m); err != nil {
+			t.Fatalf("Collect() = %v", err)
+		}
+		if m.CPUPercent == nil || *m.CPUPercent != 50 {
+			t.Errorf("CPUPercent = %v, want 50 against the first reading", m.CPUPercent)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := &cpuCollector{times: fakeTimes()}
+		if err := c.Collect(&data.HardwareMetrics{}); err == nil {
+			t.Error("Collect() = nil, want the error of times")
+		}
+	})
+}
+
+func TestBusyPercent(t *testing.T) {
+	tests := []struct {
+		name   string
+		t1, t2 cpu.TimesStat
+		want   float64
+		ok     bool
+	}{
+		{"idle", cpu.TimesStat{Idle: 100}, cpu.TimesStat{Idle: 200}, 0, true},
+		{"busy", cpu.TimesStat{User: 0, Idle: 0}, cpu.TimesStat{User: 100}, 100, true},
+		{"half", cpu.TimesStat{User: 10, System: 10, Idle: 80}, cpu.TimesStat{User: 35, System: 35, Idle: 130}, 50, true},
+		{"iowait is idle", cpu.TimesStat{Idle: 50}, cpu.TimesStat{User: 25, Idle: 100, Iowait: 25}, 25, true},
+		{"no progress", cpu.TimesStat{User: 10, Idle: 90}, cpu.TimesStat{User: 10, Idle: 90}, 0, false},
+		{"busy went back", cpu.TimesStat{User: 50, Idle: 50}, cpu.TimesStat{User: 40, Idle: 100}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := busyPercent(tt.t1, tt.t2)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("busyPercent() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
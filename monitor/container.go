@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"minator/data"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const containerStatsTimeout = 10 * time.Second
+
+// containerCollector reads per container CPU, memory and block I/O from
+// `podman stats`. Block I/O is cumulative, so like hostCollector it keeps
+// the previous reading to report rates.
+type containerCollector struct {
+	last   time.Time
+	ioPrev map[string][2]float64
+}
+
+// newContainerCollector returns nil when podman is not installed.
+func newContainerCollector() *containerCollector {
+	if _, err := exec.LookPath("podman"); err != nil {
+		return nil
+	}
+	return &containerCollector{}
+}
+
+// podmanStats is one entry of `podman stats --format json`, values are
+// human readable strings such as "1.50%" or "123.4MB / 8.2GB".
+type podmanStats struct {
+	Name       string `json:"name"`
+	CPUPercent string `json:"cpu_percent"`
+	MemUsage   string `json:"mem_usage"`
+	MemPercent string `json:"mem_percent"`
+	BlockIO    string `json:"block_io"`
+}
+
+func (c *containerCollector) Name() string { return "containers" }
+
+func (c *containerCollector) Collect(m *data.HardwareMetrics) error {
+	ctx, cancel := context.WithTimeout(context.Background(), containerStatsTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "podman", "stats", "--no-stream", "--format", "json").Output()
+	if err != nil {
+		return fmt.Errorf("podman stats: %w", err)
+	}
+	var stats []podmanStats
+	if err := json.Unmarshal(out, &stats); err != nil {
+		return fmt.Errorf("podman stats: %w", err)
+	}
+
+	elapsed := m.Timestamp.Sub(c.last).Seconds()
+	if c.last.IsZero() {
+		elapsed = 0
+	}
+	c.last = m.Timestamp
+	current := make(map[string][2]float64, len(stats))
+	for _, s := range stats {
+		labels := map[string]string{"container": s.Name}
+		if v, err := parsePercent(s.CPUPercent); err == nil {
+			m.Samples = append(m.Samples, data.Sample{Name: "container_cpu_percent", Labels: labels, Value: v})
+		}
+		if v, err := parsePercent(s.MemPercent); err == nil {
+			m.Samples = append(m.Samples, data.Sample{Name: "container_memory_percent", Labels: labels, Value: v})
+		}
+		if used, _, err := parseSizePair(s.MemUsage); err == nil {
+			m.Samples = append(m.Samples, data.Sample{Name: "container_memory_bytes", Labels: labels, Value: used})
+		}
+		read, write, err := parseSizePair(s.BlockIO)
+		if err != nil {
+			continue
+		}
+		current[s.Name] = [2]float64{read, write}
+		prev, ok := c.ioPrev[s.Name]
+		if !ok || elapsed <= 0 {
+			continue
+		}
+		m.Samples = append(m.Samples,
+			data.Sample{Name: "container_block_read_bytes_per_second", Labels: labels, Value: max(0, read-prev[0]) / elapsed},
+			data.Sample{Name: "container_block_write_bytes_per_second", Labels: labels, Value: max(0, write-prev[1]) / elapsed},
+		)
+	}
+	c.ioPrev = current
+	return nil
+}
+
+func parsePercent(v string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+}
+
+// parseSizePair parses "used / total" or "read / write" as printed by
+// podman.
+func parseSizePair(v string) (float64, float64, error) {
+	a, b, ok := strings.Cut(v, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid size pair %q", v)
+	}
+	x, err := parseSize(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := parseSize(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	// Longest suffixes first so "MiB" isn't read as "B".
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// parseSize parses sizes like "12.5MB" or "1.2GiB" into bytes.
+func parseSize(v string) (float64, error) {
+	v = strings.TrimSpace(v)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(v, u.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid size %q", v)
+			}
+			return f * u.factor, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid size %q", v)
+}
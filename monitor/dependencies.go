@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"slices"
+	"strings"
+)
+
+// resolveDependencies returns the depends_on of every check, leaving out
+// (and logging) unknown checks and dependencies that would close a cycle.
+func resolveDependencies(configs []CheckConfig) map[string][]string {
+	known := make(map[string]bool, len(configs))
+	for _, c := range configs {
+		known[c.Name] = true
+	}
+	deps := map[string][]string{}
+	for _, c := range configs {
+		for _, dep := range c.DependsOn {
+			switch {
+			case !known[dep]:
+				slog.Warn("Ignoring dependency on unknown check", "name", c.Name, "dependsOn", dep)
+			case dep == c.Name || dependsOn(deps, dep, c.Name):
+				slog.Error("Ignoring dependency that would make a cycle", "name", c.Name, "dependsOn", dep)
+			case !slices.Contains(deps[c.Name], dep):
+				deps[c.Name] = append(deps[c.Name], dep)
+			}
+		}
+	}
+	return deps
+}
+
+// dependsOn reports whether name depends on target, directly or not.
+func dependsOn(deps map[string][]string, name, target string) bool {
+	for _, dep := range deps[name] {
+		if dep == target || dependsOn(deps, dep, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// markImpacted records down checks that have a down dependency as impacted
+// by it, so only the root cause raises an alert. The root cause lists what
+// it impacts in its detail.
+func markImpacted(statuses []data.ServiceStatus, deps map[string][]string) {
+	down := map[string]bool{}
+	for _, s := range statuses {
+		if data.IsDown(s.Status) {
+			down[s.Name] = true
+		}
+	}
+	impacts := map[string][]string{}
+	for i, s := range statuses {
+		if !down[s.Name] {
+			continue
+		}
+		roots := rootCauses(deps, down, s.Name)
+		if len(roots) == 0 {
+			continue
+		}
+		statuses[i].Status = data.StatusImpacted
+		statuses[i].Detail = fmt.Sprintf("Impacted by %s: %s", strings.Join(roots, ", "), s.Detail)
+		for _, root := range roots {
+			impacts[root] = append(impacts[root], s.Name)
+		}
+	}
+	for i, s := range statuses {
+		if names := impacts[s.Name]; len(names) > 0 {
+			statuses[i].Detail = fmt.Sprintf("%s (impacts %s)", s.Detail, strings.Join(names, ", "))
+		}
+	}
+}
+
+// rootCauses follows the down dependencies of name and returns those that
+// don't have a down dependency themselves.
+func rootCauses(deps map[string][]string, down map[string]bool, name string) []string {
+	var roots []string
+	for _, dep := range deps[name] {
+		if !down[dep] {
+			continue
+		}
+		causes := rootCauses(deps, down, dep)
+		if len(causes) == 0 {
+			causes = []string{dep}
+		}
+		for _, c := range causes {
+			if !slices.Contains(roots, c) {
+				roots = append(roots, c)
+			}
+		}
+	}
+	return roots
+}
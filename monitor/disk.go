@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"log/slog"
+	"minator/data"
+	"os"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// diskMounts returns the mount points listed in MINATOR_DISK_MOUNTS
+// (comma separated), or nil to monitor every physical partition.
+func diskMounts() []string {
+	v := os.Getenv("MINATOR_DISK_MOUNTS")
+	if v == "" {
+		return nil
+	}
+	var mounts []string
+	for _, m := range strings.Split(v, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// collectDiskUsage returns the usage of the configured mounts, or of all
+// physical partitions when none are configured. Mounts that can't be read
+// are logged and left out.
+func collectDiskUsage(mounts []string) []data.DiskUsage {
+	devices := map[string]string{}
+	if len(mounts) == 0 {
+		partitions, err := disk.Partitions(false)
+		if err != nil {
+			slog.Error("Failed to list partitions", "error", err)
+			mounts = []string{"/"}
+		}
+		seen := map[string]bool{}
+		for _, p := range partitions {
+			// The same device may be mounted several times (bind mounts,
+			// btrfs subvolumes...), only count it once.
+			if seen[p.Device] {
+				continue
+			}
+			seen[p.Device] = true
+			mounts = append(mounts, p.Mountpoint)
+			devices[p.Mountpoint] = p.Device
+		}
+	}
+
+	usages := make([]data.DiskUsage, 0, len(mounts))
+	for _, mount := range mounts {
+		u, err := disk.Usage(mount)
+		if err != nil {
+			slog.Error("Failed to collect DISK metric", "mount", mount, "error", err)
+			continue
+		}
+		usages = append(usages, data.DiskUsage{
+			Mountpoint:        mount,
+			Device:            devices[mount],
+			Fstype:            u.Fstype,
+			TotalBytes:        u.Total,
+			UsedBytes:         u.Used,
+			UsedPercent:       u.UsedPercent,
+			InodesUsedPercent: u.InodesUsedPercent,
+		})
+	}
+	return usages
+}
+
+// primaryDiskPercent is what goes into the single disk_percent column: the
+// root file system if it is monitored, the first mount otherwise.
+func primaryDiskPercent(usages []data.DiskUsage) *float64 {
+	for _, u := range usages {
+		if u.Mountpoint == "/" {
+			return &u.UsedPercent
+		}
+	}
+	if len(usages) > 0 {
+		return &usages[0].UsedPercent
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"log/slog"
+	"minator/data"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/shirou/gopsutil/v4/sensors"
+)
+
+// hostCollector gathers the host metrics stored as data.Sample. Network and
+// disk I/O are cumulative counters, so it keeps the previous reading to
+// turn them into rates; the first collection has no rates.
+type hostCollector struct {
+	last    time.Time
+	netPrev map[string]net.IOCountersStat
+	ioPrev  map[string]disk.IOCountersStat
+}
+
+func newHostCollector() *hostCollector {
+	return &hostCollector{}
+}
+
+func (c *hostCollector) Name() string { return "host" }
+
+// Collect never fails as a whole, each group of samples is simply left out
+// when it can't be read.
+func (c *hostCollector) Collect(m *data.HardwareMetrics) error {
+	now := m.Timestamp
+	var samples []data.Sample
+	samples = append(samples, collectLoad()...)
+	samples = append(samples, collectSwap()...)
+
+	elapsed := now.Sub(c.last).Seconds()
+	if c.last.IsZero() {
+		elapsed = 0
+	}
+	c.last = now
+	samples = append(samples, c.collectNetwork(elapsed)...)
+	samples = append(samples, c.collectDiskIO(elapsed)...)
+	samples = append(samples, collectTemperatures()...)
+	m.Samples = append(m.Samples, samples...)
+	return nil
+}
+
+func collectLoad() []data.Sample {
+	avg, err := load.Avg()
+	if err != nil {
+		slog.Error("Failed to collect load average", "error", err)
+		return nil
+	}
+	return []data.Sample{
+		{Name: "load1", Value: avg.Load1},
+		{Name: "load5", Value: avg.Load5},
+		{Name: "load15", Value: avg.Load15},
+	}
+}
+
+func collectSwap() []data.Sample {
+	swap, err := mem.SwapMemory()
+	if err != nil {
+		slog.Error("Failed to collect swap metric", "error", err)
+		return nil
+	}
+	return []data.Sample{
+		{Name: "swap_used_percent", Value: swap.UsedPercent},
+		{Name: "swap_used_bytes", Value: float64(swap.Used)},
+	}
+}
+
+func (c *hostCollector) collectNetwork(elapsed float64) []data.Sample {
+	counters, err := net.IOCounters(true)
+	if err != nil {
+		slog.Error("Failed to collect network metrics", "error", err)
+		return nil
+	}
+	var samples []data.Sample
+	current := make(map[string]net.IOCountersStat, len(counters))
+	for _, n := range counters {
+		current[n.Name] = n
+		prev, ok := c.netPrev[n.Name]
+		if !ok || elapsed <= 0 || n.Name == "lo" {
+			continue
+		}
+		labels := map[string]string{"interface": n.Name}
+		samples = append(samples,
+			data.Sample{Name: "net_rx_bytes_per_second", Labels: labels, Value: rate(prev.BytesRecv, n.BytesRecv, elapsed)},
+			data.Sample{Name: "net_tx_bytes_per_second", Labels: labels, Value: rate(prev.BytesSent, n.BytesSent, elapsed)},
+		)
+	}
+	c.netPrev = current
+	return samples
+}
+
+func (c *hostCollector) collectDiskIO(elapsed float64) []data.Sample {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		slog.Error("Failed to collect disk I/O metrics", "error", err)
+		return nil
+	}
+	var samples []data.Sample
+	for name, d := range counters {
+		prev, ok := c.ioPrev[name]
+		if !ok || elapsed <= 0 {
+			continue
+		}
+		labels := map[string]string{"device": name}
+		samples = append(samples,
+			data.Sample{Name: "disk_read_bytes_per_second", Labels: labels, Value: rate(prev.ReadBytes, d.ReadBytes, elapsed)},
+			data.Sample{Name: "disk_write_bytes_per_second", Labels: labels, Value: rate(prev.WriteBytes, d.WriteBytes, elapsed)},
+			data.Sample{Name: "disk_read_iops", Labels: labels, Value: rate(prev.ReadCount, d.ReadCount, elapsed)},
+			data.Sample{Name: "disk_write_iops", Labels: labels, Value: rate(prev.WriteCount, d.WriteCount, elapsed)},
+		)
+	}
+	c.ioPrev = counters
+	return samples
+}
+
+// collectTemperatures returns whatever sensors could be read, hosts without
+// sensors (VMs, containers) simply have none.
+func collectTemperatures() []data.Sample {
+	temps, err := sensors.SensorsTemperatures()
+	if err != nil && len(temps) == 0 {
+		slog.Debug("No temperature sensors available", "error", err)
+		return nil
+	}
+	samples := make([]data.Sample, 0, len(temps))
+	for _, t := range temps {
+		samples = append(samples, data.Sample{
+			Name:   "temperature_celsius",
+			Labels: map[string]string{"sensor": t.SensorKey},
+			Value:  t.Temperature,
+		})
+	}
+	return samples
+}
+
+// rate returns the per second increase of a counter, a counter that went
+// backwards (reset, wrap) counts as zero.
+func rate(prev, cur uint64, elapsed float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
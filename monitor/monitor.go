@@ -6,16 +6,15 @@ import (
 	"fmt"
 	"log/slog"
 	"minator/data"
+	"minator/hub"
 	"minator/repository"
+	"minator/telemetry"
 	"net/http"
 	"os/exec"
 	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
-	"github.com/shirou/gopsutil/v4/cpu"
-	"github.com/shirou/gopsutil/v4/disk"
-	"github.com/shirou/gopsutil/v4/mem"
 )
 
 const (
@@ -24,38 +23,58 @@ const (
 )
 
 type Monitor struct {
-	HTTPClient     *http.Client
-	serviceStatus  repository.ServiceStatusRepo
-	hardwareMetric repository.HardwareMetricsRepo
+	HTTPClient *http.Client
+	// Collectors gather hardware metrics, see Collector.
+	Collectors []Collector
+	// Host is stamped on every status and metric collected.
+	Host string
+
+	sink Sink
+	// serviceStatus and heartbeat are only set on the server, agents don't
+	// evaluate heartbeats.
+	serviceStatus repository.ServiceStatusRepo
+	heartbeat     repository.HeartbeatRepo
+	checks        []check
+	dependencies  map[string][]string
 }
 
-func NewMonitor() *Monitor {
-	db, err := repository.InitDb()
-	if err != nil {
-		slog.Error("Failed to init database", "error", err)
-		return nil
-	}
-	return &Monitor{
-		HTTPClient:     &http.Client{Timeout: 5 * time.Second},
-		serviceStatus:  repository.NewServiceStatusRepo(db),
-		hardwareMetric: repository.NewHardwareMetricsRepo(db),
-	}
+// NewMonitor returns the server's monitor, which stores what it collects
+// and publishes it to the hubs.
+func NewMonitor(
+	ss repository.ServiceStatusRepo,
+	hm repository.HardwareMetricsRepo,
+	hb repository.HeartbeatRepo,
+	statusHub *hub.Hub[[]data.ServiceStatus],
+	metricHub *hub.Hub[data.HardwareMetrics],
+	checks []CheckConfig,
+) *Monitor {
+	m := newMonitor(&storeSink{
+		serviceStatus:  ss,
+		hardwareMetric: hm,
+		statusHub:      statusHub,
+		metricHub:      metricHub,
+	}, checks)
+	m.serviceStatus = ss
+	m.heartbeat = hb
+	return m
 }
 
-func collectSystemMetrics() (float64, float64, float64) {
-	cpuPercent, err := cpu.Percent(0, false)
-	if err != nil {
-		slog.Error("Failed to collect CPU metric", "error", err)
-	}
-	vm, err := mem.VirtualMemory()
-	if err != nil {
-		slog.Error("Failed to collect RAM metric", "error", err)
-	}
-	diskUsage, err := disk.Usage("/")
-	if err != nil {
-		slog.Error("Failed to collect DISK metric", "error", err)
+// NewAgentMonitor returns a monitor that hands everything it collects to
+// sink, e.g. to push it to a central server.
+func NewAgentMonitor(sink Sink, checks []CheckConfig) *Monitor {
+	return newMonitor(sink, checks)
+}
+
+func newMonitor(sink Sink, checks []CheckConfig) *Monitor {
+	m := &Monitor{
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+		Collectors: defaultCollectors(diskMounts()),
+		Host:       Hostname(),
+		sink:       sink,
 	}
-	return cpuPercent[0], vm.UsedPercent, diskUsage.UsedPercent
+	m.checks = m.buildChecks(checks)
+	m.dependencies = resolveDependencies(checks)
+	return m
 }
 
 func (m *Monitor) checkHttpHealth(url string) data.ServiceStatus {
@@ -99,30 +118,29 @@ func (m *Monitor) CheckPodmanHealth(container string) data.ServiceStatus {
 	return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("%s healthcheck failed", container)}
 }
 
-func collectHardwareMetrics() data.HardwareMetrics {
-	cpuPct, ramPct, diskPct := collectSystemMetrics()
-	return data.HardwareMetrics{
-		CPUPercent:  cpuPct,
-		RAMPercent:  ramPct,
-		DiskPercent: diskPct,
-		Timestamp:   time.Now(),
-	}
+// Dependencies returns what each check depends on.
+func (m *Monitor) Dependencies() map[string][]string {
+	return m.dependencies
+}
+
+func (m *Monitor) collectHardwareMetrics() data.HardwareMetrics {
+	metrics := runCollectors(m.Collectors, time.Now())
+	metrics.Host = m.Host
+	return metrics
 }
 
 func (m *Monitor) collectServiceStatus() []data.ServiceStatus {
 	var statuses []data.ServiceStatus
-	checks := map[string]func() data.ServiceStatus{
-		"forgejo":    func() data.ServiceStatus { return m.checkHttpHealth("http://localhost:3000/api/healthz") },
-		"privatebin": func() data.ServiceStatus { return m.checkHttpHealth("http://localhost:8080/") },
-		"postgresql": func() data.ServiceStatus { return m.CheckPodmanHealth("hl-postgres") },
-		// "nextcloud":   func() HealthStatus { return m.CheckHTTPHealth("http://localhost/nextcloud/status.php") },
-	}
-	for name, check := range checks {
-		status := check()
-		status.Name = name
+	for _, c := range m.checks {
+		start := time.Now()
+		status := c.run()
+		telemetry.ObserveCheck(c.name, start, time.Since(start))
+		status.Name = c.name
+		status.Host = m.Host
 		status.Timestamp = time.Now()
 		statuses = append(statuses, status)
 	}
+	markImpacted(statuses, m.dependencies)
 	return statuses
 }
 
@@ -144,12 +162,64 @@ func (m *Monitor) Run(ctx context.Context) {
 func (m *Monitor) collectMetrics() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ContextTimeoutSec)*time.Second)
 	defer cancel()
-	statuses := m.collectServiceStatus()
-	if err := m.serviceStatus.InsertServiceStatus(ctx, statuses); err != nil {
-		slog.Error("Failed to insert service statuses", "error", err)
+	if statuses := m.collectServiceStatus(); len(statuses) > 0 {
+		if err := m.sink.WriteStatuses(ctx, statuses); err != nil {
+			slog.Error("Failed to write service statuses", "error", err)
+		}
+	}
+	metrics := m.collectHardwareMetrics()
+	if err := m.sink.WriteMetrics(ctx, metrics); err != nil {
+		slog.Error("Failed to write metrics", "error", err)
+	}
+	if m.heartbeat != nil {
+		m.checkHeartbeats()
+	}
+}
+
+// checkHeartbeats marks services that missed their heartbeat as overdue.
+// The overdue status is only recorded once, not on every check.
+func (m *Monitor) checkHeartbeats() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ContextTimeoutSec)*time.Second)
+	defer cancel()
+	heartbeats, err := m.heartbeat.GetHeartbeats(ctx)
+	if err != nil {
+		slog.Error("Failed to get heartbeats", "error", err)
+		return
+	}
+	if len(heartbeats) == 0 {
+		return
+	}
+	latest, err := m.serviceStatus.GetLatestServiceStatus(ctx)
+	if err != nil {
+		slog.Error("Failed to get latest service statuses", "error", err)
+		return
+	}
+	current := make(map[string]string, len(latest))
+	for _, s := range latest {
+		current[s.Name] = s.Status
+	}
+
+	now := time.Now()
+	var overdue []data.ServiceStatus
+	for _, hb := range heartbeats {
+		if now.Before(hb.Deadline()) || current[hb.Name] == data.StatusOverdue {
+			continue
+		}
+		since := "it was declared"
+		if hb.LastSeen != nil {
+			since = hb.LastSeen.Format(time.DateTime)
+		}
+		overdue = append(overdue, data.ServiceStatus{
+			Name:      hb.Name,
+			Status:    data.StatusOverdue,
+			Detail:    fmt.Sprintf("No %q report since %s, expected every %s", hb.ExpectStatus, since, hb.Interval),
+			Timestamp: now,
+		})
+	}
+	if len(overdue) == 0 {
+		return
 	}
-	metrics := collectHardwareMetrics()
-	if err := m.hardwareMetric.InsertHardwareMetrics(ctx, metrics); err != nil {
-		slog.Error("Failed to insert metrics", "error", err)
+	if err := m.sink.WriteStatuses(ctx, overdue); err != nil {
+		slog.Error("Failed to write overdue statuses", "error", err)
 	}
 }
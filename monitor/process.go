@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"log/slog"
+	"minator/data"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+const defaultTopProcesses = 5
+
+// processCollector reports the top processes by CPU and by memory. CPU and
+// I/O are cumulative per process, so the previous reading of every process
+// is kept to compute rates.
+type processCollector struct {
+	top  int
+	last time.Time
+	prev map[int32]processReading
+}
+
+type processReading struct {
+	name                string
+	cpuSeconds          float64
+	rss                 uint64
+	readBytes           uint64
+	writeBytes          uint64
+	cpuPercent          float64
+	readRate, writeRate float64
+	hasRates            bool
+}
+
+// newProcessCollector reads the number of processes to report from
+// MINATOR_TOP_PROCESSES, 0 disables the collector.
+func newProcessCollector() *processCollector {
+	top := defaultTopProcesses
+	if v := os.Getenv("MINATOR_TOP_PROCESSES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			slog.Warn("Invalid MINATOR_TOP_PROCESSES, using default", "value", v, "default", defaultTopProcesses)
+		} else {
+			top = n
+		}
+	}
+	if top == 0 {
+		return nil
+	}
+	return &processCollector{top: top}
+}
+
+func (c *processCollector) Name() string { return "processes" }
+
+func (c *processCollector) Collect(m *data.HardwareMetrics) error {
+	procs, err := process.Processes()
+	if err != nil {
+		return err
+	}
+	elapsed := m.Timestamp.Sub(c.last).Seconds()
+	if c.last.IsZero() {
+		elapsed = 0
+	}
+	c.last = m.Timestamp
+	current := make(map[int32]processReading, len(procs))
+	for _, p := range procs {
+		times, err := p.Times()
+		if err != nil {
+			// Gone already, or not ours to read.
+			continue
+		}
+		r := processReading{cpuSeconds: times.User + times.System}
+		if r.name, err = p.Name(); err != nil {
+			continue
+		}
+		if mem, err := p.MemoryInfo(); err == nil {
+			r.rss = mem.RSS
+		}
+		if io, err := p.IOCounters(); err == nil {
+			r.readBytes, r.writeBytes = io.ReadBytes, io.WriteBytes
+		}
+		if prev, ok := c.prev[p.Pid]; ok && prev.name == r.name && elapsed > 0 {
+			r.cpuPercent = max(0, r.cpuSeconds-prev.cpuSeconds) / elapsed * 100
+			r.readRate = rate(prev.readBytes, r.readBytes, elapsed)
+			r.writeRate = rate(prev.writeBytes, r.writeBytes, elapsed)
+			r.hasRates = true
+		}
+		current[p.Pid] = r
+	}
+	c.prev = current
+
+	for _, r := range c.topProcesses(byName(current)) {
+		labels := map[string]string{"process": r.name}
+		m.Samples = append(m.Samples, data.Sample{Name: "process_memory_bytes", Labels: labels, Value: float64(r.rss)})
+		if r.hasRates {
+			m.Samples = append(m.Samples,
+				data.Sample{Name: "process_cpu_percent", Labels: labels, Value: r.cpuPercent},
+				data.Sample{Name: "process_io_read_bytes_per_second", Labels: labels, Value: r.readRate},
+				data.Sample{Name: "process_io_write_bytes_per_second", Labels: labels, Value: r.writeRate},
+			)
+		}
+	}
+	return nil
+}
+
+// byName adds up the readings of processes sharing a name, such as the
+// workers of a server. Samples are keyed by name only: a PID label would
+// start a new series on every restart.
+func byName(readings map[int32]processReading) []processReading {
+	sums := map[string]*processReading{}
+	for _, r := range readings {
+		sum, ok := sums[r.name]
+		if !ok {
+			sum = &processReading{name: r.name}
+			sums[r.name] = sum
+		}
+		sum.rss += r.rss
+		if r.hasRates {
+			sum.cpuPercent += r.cpuPercent
+			sum.readRate += r.readRate
+			sum.writeRate += r.writeRate
+			sum.hasRates = true
+		}
+	}
+	all := make([]processReading, 0, len(sums))
+	for _, sum := range sums {
+		all = append(all, *sum)
+	}
+	return all
+}
+
+// topProcesses returns the union of the top processes by CPU and by memory.
+func (c *processCollector) topProcesses(readings []processReading) []processReading {
+	selected := map[string]bool{}
+	sort.Slice(readings, func(i, j int) bool { return readings[i].cpuPercent > readings[j].cpuPercent })
+	for _, r := range readings[:min(c.top, len(readings))] {
+		// Idle processes would be an arbitrary pick.
+		if r.cpuPercent > 0 {
+			selected[r.name] = true
+		}
+	}
+	sort.Slice(readings, func(i, j int) bool { return readings[i].rss > readings[j].rss })
+	for _, r := range readings[:min(c.top, len(readings))] {
+		selected[r.name] = true
+	}
+	var top []processReading
+	for _, r := range readings {
+		if selected[r.name] {
+			top = append(top, r)
+		}
+	}
+	return top
+}
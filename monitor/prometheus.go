@@ -0,0 +1,276 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"minator/data"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxScrapeSize bounds how much of a /metrics page is read.
+const maxScrapeSize = 16 << 20
+
+// PrometheusCheck scrapes URL, a page in the Prometheus text format, and
+// compares every series matching Metric and Labels to Value. The check is
+// unhealthy when no series matches or when any of them fails the
+// comparison.
+type PrometheusCheck struct {
+	URL    string
+	Metric string
+	Labels map[string]string
+	Op     string
+	Value  float64
+}
+
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func newPrometheusCheck(c CheckConfig) (*PrometheusCheck, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	if c.Expr == "" {
+		return nil, fmt.Errorf("expr is required")
+	}
+	pc, err := parseExpr(c.Expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expr: %v", err)
+	}
+	pc.URL = c.URL
+	return pc, nil
+}
+
+// parseExpr parses `metric{label="value",...} op number`, the labels being
+// optional.
+func parseExpr(expr string) (*PrometheusCheck, error) {
+	expr = strings.TrimSpace(expr)
+	end := strings.IndexAny(expr, "{=!<> \t")
+	if end <= 0 {
+		return nil, fmt.Errorf("expected a metric name followed by a comparison")
+	}
+	pc := &PrometheusCheck{Metric: expr[:end]}
+	rest := strings.TrimSpace(expr[end:])
+	if strings.HasPrefix(rest, "{") {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return nil, err
+		}
+		pc.Labels = labels
+		rest = strings.TrimSpace(rest[n:])
+	}
+	for _, op := range comparisonOps {
+		if strings.HasPrefix(rest, op) {
+			pc.Op = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if pc.Op == "" {
+		return nil, fmt.Errorf("expected one of %s after the metric", strings.Join(comparisonOps, " "))
+	}
+	v, err := parseValue(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", rest)
+	}
+	pc.Value = v
+	return pc, nil
+}
+
+func (c *PrometheusCheck) run(client *http.Client) data.ServiceStatus {
+	resp, err := client.Get(c.URL)
+	if err != nil {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("Scrape failed: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("Unexpected HTTP status: %d", resp.StatusCode)}
+	}
+	values, err := c.scan(io.LimitReader(resp.Body, maxScrapeSize))
+	if err != nil {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("Failed to parse %s: %v", c.URL, err)}
+	}
+	return c.evaluate(values)
+}
+
+// scan returns the value of every series of r matching the check, keyed by
+// its label set as written in the page.
+func (c *PrometheusCheck) scan(r io.Reader) (map[string]float64, error) {
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || !strings.HasPrefix(line, c.Metric) {
+			continue
+		}
+		rest := line[len(c.Metric):]
+		if rest == "" || (rest[0] != '{' && rest[0] != ' ' && rest[0] != '\t') {
+			continue // another metric sharing the prefix
+		}
+		var labels map[string]string
+		series := ""
+		if rest[0] == '{' {
+			var n int
+			var err error
+			labels, n, err = parseLabels(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", c.Metric, err)
+			}
+			series, rest = rest[:n], rest[n:]
+		}
+		if !c.matches(labels) {
+			continue
+		}
+		// The value may be followed by a timestamp.
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s%s has no value", c.Metric, series)
+		}
+		v, err := parseValue(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s%s: invalid value %q", c.Metric, series, fields[0])
+		}
+		values[series] = v
+	}
+	return values, scanner.Err()
+}
+
+func (c *PrometheusCheck) matches(labels map[string]string) bool {
+	for k, v := range c.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *PrometheusCheck) evaluate(values map[string]float64) data.ServiceStatus {
+	if len(values) == 0 {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("No series matches %s", c.selector())}
+	}
+	var observed, failed []string
+	for _, series := range slices.Sorted(maps.Keys(values)) {
+		s := fmt.Sprintf("%s%s = %s", c.Metric, series, formatValue(values[series]))
+		observed = append(observed, s)
+		if !compare(values[series], c.Op, c.Value) {
+			failed = append(failed, s)
+		}
+	}
+	want := fmt.Sprintf("%s %s", c.Op, formatValue(c.Value))
+	if len(failed) > 0 {
+		return data.ServiceStatus{Status: "unhealthy", Detail: fmt.Sprintf("%s, expected %s", truncate(failed), want)}
+	}
+	return data.ServiceStatus{Status: "healthy", Detail: fmt.Sprintf("%s (%s)", truncate(observed), want)}
+}
+
+// truncate joins series, keeping the detail readable when many of them
+// match.
+func truncate(series []string) string {
+	const maxSeries = 10
+	if len(series) <= maxSeries {
+		return strings.Join(series, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(series[:maxSeries], ", "), len(series)-maxSeries)
+}
+
+func (c *PrometheusCheck) selector() string {
+	if len(c.Labels) == 0 {
+		return c.Metric
+	}
+	pairs := make([]string, 0, len(c.Labels))
+	for _, k := range slices.Sorted(maps.Keys(c.Labels)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, c.Labels[k]))
+	}
+	return c.Metric + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func compare(v float64, op string, want float64) bool {
+	switch op {
+	case "==":
+		return v == want
+	case "!=":
+		return v != want
+	case "<":
+		return v < want
+	case "<=":
+		return v <= want
+	case ">":
+		return v > want
+	case ">=":
+		return v >= want
+	}
+	return false
+}
+
+// parseLabels parses the `{name="value",...}` at the start of s and returns
+// the labels and the length of the block.
+func parseLabels(s string) (map[string]string, int, error) {
+	labels := map[string]string{}
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated label set")
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 {
+			return nil, 0, fmt.Errorf("expected label=\"value\"")
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("label %s: expected a quoted value", name)
+		}
+		var value strings.Builder
+		i++
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("label %s: unterminated value", name)
+		}
+		labels[name] = value.String()
+		i++
+	}
+}
+
+// parseValue parses a sample value, including the +Inf, -Inf and NaN
+// spellings of the text format.
+func parseValue(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,180 @@
+package monitor
+
+import (
+	"maps"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    PrometheusCheck
+		wantErr bool
+	}{
+		{expr: "up == 1", want: PrometheusCheck{Metric: "up", Op: "==", Value: 1}},
+		{expr: "  queue_size<=100  ", want: PrometheusCheck{Metric: "queue_size", Op: "<=", Value: 100}},
+		{expr: "temp >= -5.5", want: PrometheusCheck{Metric: "temp", Op: ">=", Value: -5.5}},
+		{expr: `up{job="api",instance="a:9100"} != 0`,
+			want: PrometheusCheck{Metric: "up", Labels: map[string]string{"job": "api", "instance": "a:9100"}, Op: "!=", Value: 0}},
+		{expr: `errors{path="/a b"} < +Inf`,
+			want: PrometheusCheck{Metric: "errors", Labels: map[string]string{"path": "/a b"}, Op: "<", Value: math.Inf(1)}},
+		{expr: "up", wantErr: true},
+		{expr: "== 1", wantErr: true},
+		{expr: "up = 1", wantErr: true},
+		{expr: "up == one", wantErr: true},
+		{expr: `up{job="api" == 1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseExpr(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseExpr() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExpr() = %v", err)
+			}
+			if got.Metric != tt.want.Metric || got.Op != tt.want.Op || got.Value != tt.want.Value ||
+				!maps.Equal(got.Labels, tt.want.Labels) {
+				t.Errorf("parseExpr() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    map[string]string
+		n       int
+		wantErr bool
+	}{
+		{name: "empty", in: "{} 1", want: map[string]string{}, n: 2},
+		{name: "several", in: `{a="1",b="2"} 3`, want: map[string]string{"a": "1", "b": "2"}, n: 13},
+		{name: "spaces and trailing comma", in: `{ a = "1", b="2", } 3`, want: map[string]string{"a": "1", "b": "2"}, n: 19},
+		{name: "escaped quote", in: `{a="say \"hi\""}`, want: map[string]string{"a": `say "hi"`}, n: 16},
+		{name: "escaped backslash", in: `{path="C:\\temp"}`, want: map[string]string{"path": `C:\temp`}, n: 17},
+		{name: "escaped newline", in: `{msg="a\nb"}`, want: map[string]string{"msg": "a\nb"}, n: 12},
+		{name: "braces in value", in: `{re="x{2}"} 1`, want: map[string]string{"re": "x{2}"}, n: 11},
+		{name: "unterminated set", in: `{a="1"`, wantErr: true},
+		{name: "unterminated value", in: `{a="1}`, wantErr: true},
+		{name: "unquoted value", in: `{a=1}`, wantErr: true},
+		{name: "missing name", in: `{="1"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := parseLabels(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLabels() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLabels() = %v", err)
+			}
+			if !maps.Equal(got, tt.want) || n != tt.n {
+				t.Errorf("parseLabels() = %v, %d, want %v, %d", got, n, tt.want, tt.n)
+			}
+		})
+	}
+}
+
+const scrapePage = `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{code="200",path="/"} 1027 1395066363000
+http_requests_total{code="500",path="/"} 3 1395066363000
+http_requests_total_created{code="200",path="/"} 1395066363
+http_requests_totalish 7
+http_requests_total{code="200",path="/say \"hi\""} 12
+http_requests_total{code="404",path="/a,b}"}	+Inf
+
+up 1
+upstream_up 0
+`
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric string
+		labels map[string]string
+		want   map[string]float64
+	}{
+		{
+			name:   "prefix-sharing names are skipped",
+			metric: "up",
+			want:   map[string]float64{"": 1},
+		},
+		{
+			name:   "timestamps are ignored",
+			metric: "http_requests_total",
+			labels: map[string]string{"path": "/"},
+			want:   map[string]float64{`{code="200",path="/"}`: 1027, `{code="500",path="/"}`: 3},
+		},
+		{
+			name:   "escaped label values",
+			metric: "http_requests_total",
+			labels: map[string]string{"path": `/say "hi"`},
+			want:   map[string]float64{`{code="200",path="/say \"hi\""}`: 12},
+		},
+		{
+			name:   "separators in label values",
+			metric: "http_requests_total",
+			labels: map[string]string{"code": "404"},
+			want:   map[string]float64{`{code="404",path="/a,b}"}`: math.Inf(1)},
+		},
+		{
+			name:   "no match",
+			metric: "http_requests_total",
+			labels: map[string]string{"code": "302"},
+			want:   map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &PrometheusCheck{Metric: tt.metric, Labels: tt.labels}
+			got, err := c.scan(strings.NewReader(scrapePage))
+			if err != nil {
+				t.Fatalf("scan() = %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	tests := map[string]string{
+		"no value":           "up{job=\"api\"}\n",
+		"invalid value":      "up one\n",
+		"unterminated value": "up{job=\"api} 1\n",
+	}
+	for name, page := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &PrometheusCheck{Metric: "up"}
+			if got, err := c.scan(strings.NewReader(page)); err == nil {
+				t.Errorf("scan() = %v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	c := &PrometheusCheck{Metric: "up", Op: "==", Value: 1}
+	if s := c.evaluate(map[string]float64{}); s.Status != "unhealthy" {
+		t.Errorf("evaluate() without series = %s, want unhealthy", s.Status)
+	}
+	if s := c.evaluate(map[string]float64{`{i="a"}`: 1, `{i="b"}`: 1}); s.Status != "healthy" {
+		t.Errorf("evaluate() = %s (%s), want healthy", s.Status, s.Detail)
+	}
+	s := c.evaluate(map[string]float64{`{i="a"}`: 1, `{i="b"}`: 0})
+	if s.Status != "unhealthy" || s.Detail != `up{i="b"} = 0, expected == 1` {
+		t.Errorf("evaluate() = %s (%s), want unhealthy for b only", s.Status, s.Detail)
+	}
+}
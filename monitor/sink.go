@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"context"
+	"minator/data"
+	"minator/hub"
+	"minator/repository"
+	"os"
+)
+
+// Sink receives everything the monitor collects. The server stores it and
+// publishes it to live subscribers, an agent sends it to the server.
+type Sink interface {
+	WriteStatuses(ctx context.Context, statuses []data.ServiceStatus) error
+	WriteMetrics(ctx context.Context, metrics data.HardwareMetrics) error
+}
+
+// storeSink stores into the database and publishes to the hubs. Data is
+// published even when storing fails so dashboards stay live.
+type storeSink struct {
+	serviceStatus  repository.ServiceStatusRepo
+	hardwareMetric repository.HardwareMetricsRepo
+	statusHub      *hub.Hub[[]data.ServiceStatus]
+	metricHub      *hub.Hub[data.HardwareMetrics]
+}
+
+func (s *storeSink) WriteStatuses(ctx context.Context, statuses []data.ServiceStatus) error {
+	err := s.serviceStatus.InsertServiceStatus(ctx, statuses)
+	s.statusHub.Publish(statuses)
+	return err
+}
+
+func (s *storeSink) WriteMetrics(ctx context.Context, metrics data.HardwareMetrics) error {
+	err := s.hardwareMetric.InsertHardwareMetrics(ctx, metrics)
+	s.metricHub.Publish(metrics)
+	return err
+}
+
+// Hostname is the host this process reports as: MINATOR_HOST if set,
+// otherwise the system host name.
+func Hostname() string {
+	if host := os.Getenv("MINATOR_HOST"); host != "" {
+		return host
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "localhost"
+	}
+	return host
+}
@@ -44,6 +44,12 @@ func InitDb() (*sql.DB, error) {
 
 	NewServiceStatusRepo(db).CreateTableIfNotExists(ctx)
 	NewHardwareMetricsRepo(db).CreateTableIfNotExists(ctx)
+	NewAPITokenRepo(db).CreateTableIfNotExists(ctx)
+	NewHeartbeatRepo(db).CreateTableIfNotExists(ctx)
+	NewJobRunRepo(db).CreateTableIfNotExists(ctx)
+	NewMaintenanceRepo(db).CreateTableIfNotExists(ctx)
+	NewAlertRepo(db).CreateTableIfNotExists(ctx)
+	NewIncidentRepo(db).CreateTableIfNotExists(ctx)
 	db.Close()
 
 	// Connect as minator user for normal operations
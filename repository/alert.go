@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"strings"
+	"time"
+)
+
+const tblAlerts = "alerts"
+
+// AlertRepo keeps the state of alerts so escalations and acknowledgements
+// survive restarts. An alert is one row from the moment it fires until it
+// is resolved.
+type AlertRepo interface {
+	// InsertAlert stores a firing alert and sets its ID.
+	InsertAlert(ctx context.Context, a *data.Alert) error
+	// UpdateEscalation records that escalation steps up to a.Escalation
+	// were notified, last at a.LastNotifiedAt.
+	UpdateEscalation(ctx context.Context, a data.Alert) error
+	AckAlert(ctx context.Context, id int64, by string, at time.Time) error
+	ResolveAlert(ctx context.Context, a data.Alert) error
+	// GetOpenAlerts returns the alerts that are not resolved yet.
+	GetOpenAlerts(ctx context.Context) ([]data.Alert, error)
+	// GetAlerts returns the alerts that were open at some point between
+	// q.From and q.To, in the order they fired.
+	GetAlerts(ctx context.Context, q AlertQuery) ([]data.Alert, error)
+	CreateTableIfNotExists(ctx context.Context)
+}
+
+// AlertQuery selects alert history.
+type AlertQuery struct {
+	From   time.Time
+	To     time.Time
+	States []string // "firing", "acknowledged" or "resolved", empty means any
+	Limit  int
+}
+
+type alertRepo struct {
+	db *sql.DB
+}
+
+func NewAlertRepo(db *sql.DB) AlertRepo {
+	return &alertRepo{db: db}
+}
+
+func (m *alertRepo) InsertAlert(ctx context.Context, a *data.Alert) error {
+	return m.db.QueryRowContext(ctx, `
+		INSERT INTO `+tblAlerts+` (name, status, detail, fired_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		a.Name, a.Status, a.Detail, toLocal(a.FiredAt)).Scan(&a.ID)
+}
+
+func (m *alertRepo) UpdateEscalation(ctx context.Context, a data.Alert) error {
+	var notifiedAt any
+	if a.LastNotifiedAt != nil {
+		notifiedAt = toLocal(*a.LastNotifiedAt)
+	}
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE `+tblAlerts+` SET escalation = $2, last_notified_at = $3
+		WHERE id = $1`,
+		a.ID, a.Escalation, notifiedAt)
+	return err
+}
+
+func (m *alertRepo) AckAlert(ctx context.Context, id int64, by string, at time.Time) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE `+tblAlerts+` SET acked_at = $2, acked_by = $3
+		WHERE id = $1 AND resolved_at IS NULL AND acked_at IS NULL`,
+		id, toLocal(at), by)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *alertRepo) ResolveAlert(ctx context.Context, a data.Alert) error {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE `+tblAlerts+` SET resolved_at = $2, resolved_status = $3, resolved_detail = $4
+		WHERE id = $1`,
+		a.ID, toLocal(a.Timestamp), a.Status, a.Detail)
+	return err
+}
+
+func (m *alertRepo) GetOpenAlerts(ctx context.Context) ([]data.Alert, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+alertColumns+`
+		FROM `+tblAlerts+`
+		WHERE resolved_at IS NULL
+		ORDER BY fired_at;`)
+	if err != nil {
+		slog.Error("Failed to query open alerts", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAlerts(rows)
+}
+
+func (m *alertRepo) GetAlerts(ctx context.Context, q AlertQuery) ([]data.Alert, error) {
+	where := []string{"fired_at <= $1", "(resolved_at IS NULL OR resolved_at >= $2)"}
+	args := []any{toLocal(q.To), toLocal(q.From)}
+	var states []string
+	for _, state := range q.States {
+		switch state {
+		case "firing":
+			states = append(states, "(resolved_at IS NULL AND acked_at IS NULL)")
+		case "acknowledged":
+			states = append(states, "(resolved_at IS NULL AND acked_at IS NOT NULL)")
+		case "resolved":
+			states = append(states, "resolved_at IS NOT NULL")
+		default:
+			return nil, fmt.Errorf("unknown alert state %q", state)
+		}
+	}
+	if len(states) > 0 {
+		where = append(where, "("+strings.Join(states, " OR ")+")")
+	}
+	args = append(args, q.Limit)
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE %s
+		ORDER BY fired_at, id
+		LIMIT $%d;`,
+		alertColumns, tblAlerts, strings.Join(where, " AND "), len(args)), args...)
+	if err != nil {
+		slog.Error("Failed to query alerts", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAlerts(rows)
+}
+
+const alertColumns = "id, name, status, detail, fired_at, acked_at, acked_by, escalation, last_notified_at, resolved_at, COALESCE(resolved_status, '')"
+
+// scanAlerts reads alertColumns rows. The state and timestamp of an alert
+// are those of its latest event.
+func scanAlerts(rows *sql.Rows) ([]data.Alert, error) {
+	var alerts []data.Alert
+	for rows.Next() {
+		var (
+			a                               data.Alert
+			ackedAt, notifiedAt, resolvedAt sql.NullTime
+		)
+		if err := rows.Scan(&a.ID, &a.Name, &a.Status, &a.Detail, &a.FiredAt, &ackedAt, &a.AckedBy,
+			&a.Escalation, &notifiedAt, &resolvedAt, &a.ResolvedStatus); err != nil {
+			slog.Error("Failed to scan alert", "error", err)
+			return nil, err
+		}
+		a.FiredAt = asLocal(a.FiredAt)
+		a.AckedAt = nullTime(ackedAt)
+		a.LastNotifiedAt = nullTime(notifiedAt)
+		a.ResolvedAt = nullTime(resolvedAt)
+		a.State, a.Timestamp = "firing", a.FiredAt
+		if a.AckedAt != nil {
+			a.State, a.Timestamp = "acknowledged", *a.AckedAt
+		}
+		if a.ResolvedAt != nil {
+			a.State, a.Timestamp = "resolved", *a.ResolvedAt
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+func (m *alertRepo) CreateTableIfNotExists(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			status VARCHAR(50) NOT NULL,
+			detail TEXT NOT NULL DEFAULT '',
+			fired_at TIMESTAMP NOT NULL,
+			acked_at TIMESTAMP,
+			acked_by VARCHAR(255) NOT NULL DEFAULT '',
+			escalation INT NOT NULL DEFAULT 0,
+			last_notified_at TIMESTAMP,
+			resolved_at TIMESTAMP,
+			resolved_status VARCHAR(50),
+			resolved_detail TEXT
+		);
+		CREATE INDEX IF NOT EXISTS idx_alerts_open ON %s (fired_at) WHERE resolved_at IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_alerts_fired_at ON %s (fired_at);
+		COMMENT ON TABLE %s IS 'Stores alerts from firing until resolved';
+		GRANT ALL ON %s TO minator;
+		GRANT USAGE, SELECT ON SEQUENCE alerts_id_seq TO minator;`,
+		tblAlerts, tblAlerts, tblAlerts, tblAlerts, tblAlerts)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblAlerts, "error", err)
+	}
+}
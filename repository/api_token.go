@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const tblAPITokens = "api_tokens"
+
+// ErrNotFound is returned when the requested row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrExists is returned when inserting a row whose key is already taken.
+var ErrExists = errors.New("already exists")
+
+type APITokenRepo interface {
+	CreateToken(ctx context.Context, name string, services, hosts []string, hash string) (data.APIToken, error)
+	ListTokens(ctx context.Context) ([]data.APIToken, error)
+	RevokeToken(ctx context.Context, id int64) error
+	// UseToken looks up an active token by hash and records it as used.
+	UseToken(ctx context.Context, hash string) (data.APIToken, error)
+	CreateTableIfNotExists(ctx context.Context)
+}
+
+type apiTokenRepo struct {
+	db *sql.DB
+}
+
+func NewAPITokenRepo(db *sql.DB) APITokenRepo {
+	return &apiTokenRepo{db: db}
+}
+
+func (m *apiTokenRepo) CreateToken(ctx context.Context, name string, services, hosts []string, hash string) (data.APIToken, error) {
+	if hosts == nil {
+		hosts = []string{}
+	}
+	t := data.APIToken{Name: name, Services: services, Hosts: hosts, CreatedAt: time.Now()}
+	err := m.db.QueryRowContext(ctx, `
+		INSERT INTO `+tblAPITokens+` (name, services, hosts, token_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		name, pq.Array(services), pq.Array(hosts), hash, toLocal(t.CreatedAt)).Scan(&t.ID)
+	return t, err
+}
+
+func (m *apiTokenRepo) ListTokens(ctx context.Context) ([]data.APIToken, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT id, name, services, hosts, created_at, last_used_at, revoked_at
+		FROM `+tblAPITokens+`
+		ORDER BY id;`)
+	if err != nil {
+		slog.Error("Failed to query API tokens", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var tokens []data.APIToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			slog.Error("Failed to scan API token", "error", err)
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (m *apiTokenRepo) RevokeToken(ctx context.Context, id int64) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE `+tblAPITokens+` SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL`,
+		id, toLocal(time.Now()))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *apiTokenRepo) UseToken(ctx context.Context, hash string) (data.APIToken, error) {
+	row := m.db.QueryRowContext(ctx, `
+		UPDATE `+tblAPITokens+` SET last_used_at = $2
+		WHERE token_hash = $1 AND revoked_at IS NULL
+		RETURNING id, name, services, hosts, created_at, last_used_at, revoked_at`,
+		hash, toLocal(time.Now()))
+	t, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrNotFound
+	}
+	return t, err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row scanner) (data.APIToken, error) {
+	var (
+		t                   data.APIToken
+		lastUsed, revokedAt sql.NullTime
+	)
+	if err := row.Scan(&t.ID, &t.Name, pq.Array(&t.Services), pq.Array(&t.Hosts), &t.CreatedAt, &lastUsed, &revokedAt); err != nil {
+		return t, err
+	}
+	t.CreatedAt = asLocal(t.CreatedAt)
+	t.LastUsedAt = nullTime(lastUsed)
+	t.RevokedAt = nullTime(revokedAt)
+	return t, nil
+}
+
+func (m *apiTokenRepo) CreateTableIfNotExists(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			services TEXT[] NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP,
+			revoked_at TIMESTAMP
+		);
+		-- hosts was added to bind agents to their host, older tokens have none.
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS hosts TEXT[] NOT NULL DEFAULT '{}';
+		COMMENT ON TABLE %s IS 'Stores hashed tokens for the push API';
+		GRANT ALL ON %s TO minator;
+		GRANT USAGE, SELECT ON SEQUENCE api_tokens_id_seq TO minator;`,
+		tblAPITokens, tblAPITokens, tblAPITokens, tblAPITokens)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblAPITokens, "error", err)
+	}
+}
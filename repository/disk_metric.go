@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const tblDiskMetrics = "disk_metrics"
+
+// insertDiskMetrics stores one row per mount, sharing the timestamp of the
+// hardware metrics they were collected with.
+func insertDiskMetrics(ctx context.Context, tx *sql.Tx, s data.HardwareMetrics) error {
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO `+tblDiskMetrics+` (timestamp, host, mountpoint, device, fstype, total_bytes, used_bytes, used_percent, inodes_used_percent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, d := range s.Disks {
+		if _, err := stmt.ExecContext(ctx, toLocal(s.Timestamp), s.Host, d.Mountpoint, d.Device, d.Fstype,
+			int64(d.TotalBytes), int64(d.UsedBytes), d.UsedPercent, d.InodesUsedPercent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryDiskMetrics returns per mount series between q.From and q.To
+// aggregated like QueryMetrics. An empty mounts returns every mount seen in
+// the range.
+func (h *hardwareMetricsRepo) QueryDiskMetrics(ctx context.Context, q MetricsQuery, mounts []string) (map[string][]data.DiskPoint, error) {
+	agg, ok := aggregations[q.Agg]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	query := fmt.Sprintf(`
+		SELECT mountpoint,
+			timestamp 'epoch' + floor(extract(epoch FROM timestamp) / $3) * $3 * interval '1 second' AS bucket,
+			(%s)::float8 AS used_percent,
+			(%s)::float8 AS inodes_used_percent,
+			(%s)::float8 AS used_bytes
+		FROM %s
+		WHERE timestamp >= $1 AND timestamp < $2 AND host = $5
+			AND (cardinality($4::text[]) = 0 OR mountpoint = ANY($4))
+		GROUP BY mountpoint, bucket
+		ORDER BY mountpoint, bucket ASC;`,
+		fmt.Sprintf(agg, "used_percent"), fmt.Sprintf(agg, "inodes_used_percent"), fmt.Sprintf(agg, "used_bytes"),
+		tblDiskMetrics)
+	if mounts == nil {
+		mounts = []string{}
+	}
+	rows, err := h.db.QueryContext(ctx, query, toLocal(q.From), toLocal(q.To), q.Step.Seconds(), pq.Array(mounts), q.Host)
+	if err != nil {
+		slog.Error("Failed to query disk metrics", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	series := map[string][]data.DiskPoint{}
+	for rows.Next() {
+		var (
+			mount string
+			p     data.DiskPoint
+		)
+		if err := rows.Scan(&mount, &p.Timestamp, &p.UsedPercent, &p.InodesUsedPercent, &p.UsedBytes); err != nil {
+			slog.Error("Failed to scan disk metric row", "error", err)
+			return nil, err
+		}
+		p.Timestamp = asLocal(p.Timestamp)
+		series[mount] = append(series[mount], p)
+	}
+	return series, rows.Err()
+}
+
+// disksAt returns the disks of host collected at ts.
+func (h *hardwareMetricsRepo) disksAt(ctx context.Context, host string, ts time.Time) ([]data.DiskUsage, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT mountpoint, device, fstype, total_bytes, used_bytes, used_percent, inodes_used_percent
+		FROM `+tblDiskMetrics+`
+		WHERE host = $1 AND timestamp = $2
+		ORDER BY mountpoint;`, host, toLocal(ts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var disks []data.DiskUsage
+	for rows.Next() {
+		var (
+			d           data.DiskUsage
+			total, used int64
+		)
+		if err := rows.Scan(&d.Mountpoint, &d.Device, &d.Fstype, &total, &used, &d.UsedPercent, &d.InodesUsedPercent); err != nil {
+			return nil, err
+		}
+		d.TotalBytes, d.UsedBytes = uint64(total), uint64(used)
+		disks = append(disks, d)
+	}
+	return disks, rows.Err()
+}
+
+func (h *hardwareMetricsRepo) createDiskTableIfNotExists(ctx context.Context) {
+	if _, err := h.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			mountpoint TEXT NOT NULL,
+			device TEXT NOT NULL DEFAULT '',
+			fstype TEXT NOT NULL DEFAULT '',
+			total_bytes BIGINT NOT NULL,
+			used_bytes BIGINT NOT NULL,
+			used_percent FLOAT NOT NULL,
+			inodes_used_percent FLOAT NOT NULL
+		);
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_disk_metrics_mountpoint_timestamp ON %s (mountpoint, timestamp DESC);
+		CREATE INDEX IF NOT EXISTS idx_disk_metrics_host_timestamp ON %s (host, timestamp);
+		CREATE INDEX IF NOT EXISTS idx_disk_metrics_timestamp ON %s (timestamp);
+		COMMENT ON TABLE %s IS 'Stores disk usage per mount point on homelab';
+		GRANT ALL ON %s TO minator;
+		GRANT USAGE, SELECT ON SEQUENCE disk_metrics_id_seq TO minator;`,
+		tblDiskMetrics, tblDiskMetrics, tblDiskMetrics, tblDiskMetrics, tblDiskMetrics, tblDiskMetrics, tblDiskMetrics)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblDiskMetrics, "error", err)
+	}
+}
@@ -3,22 +3,59 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"minator/data"
-	"net/http"
+	"minator/telemetry"
 	"time"
 )
 
 const tblHardwareMetrics = "hardware_metrics"
 
 type HardwareMetricsRepo interface {
-	GetMetrics(w http.ResponseWriter, f http.Flusher, group string, lastTimestamp time.Time) time.Time
+	GetMetrics(ctx context.Context, host, group string, since time.Time) ([]data.HardwareMetrics, error)
+	QueryMetrics(ctx context.Context, q MetricsQuery) ([]data.HardwareMetrics, error)
+	QueryDiskMetrics(ctx context.Context, q MetricsQuery, mounts []string) (map[string][]data.DiskPoint, error)
+	QuerySamples(ctx context.Context, q MetricsQuery, names []string) ([]data.SampleSeries, error)
 	InsertHardwareMetrics(ctx context.Context, s data.HardwareMetrics) error
+	GetLatestMetrics(ctx context.Context, since time.Time) ([]data.HardwareMetrics, error)
+	ListHosts(ctx context.Context, since time.Time) ([]string, error)
+	ClaimUnassigned(ctx context.Context, host string) error
 	CreateTableIfNotExists(ctx context.Context)
 }
 
+// MetricsQuery aggregates the metrics of Host between From and To into
+// buckets of Step using the aggregation function Agg (see ValidAggregation).
+type MetricsQuery struct {
+	Host string
+	From time.Time
+	To   time.Time
+	Step time.Duration
+	Agg  string
+}
+
+// aggregations maps supported aggregation names to their SQL expression.
+var aggregations = map[string]string{
+	"avg": "AVG(%s)",
+	"min": "MIN(%s)",
+	"max": "MAX(%s)",
+	"p95": "percentile_cont(0.95) WITHIN GROUP (ORDER BY %s)",
+}
+
+func ValidAggregation(agg string) bool {
+	_, ok := aggregations[agg]
+	return ok
+}
+
+// ValidGroup reports whether GetMetrics supports group.
+func ValidGroup(group string) bool {
+	switch group {
+	case "none", "minute", "hour", "day", "month":
+		return true
+	}
+	return false
+}
+
 type hardwareMetricsRepo struct {
 	db *sql.DB
 }
@@ -43,7 +80,11 @@ func calculateLimit(group string) int {
 	}
 }
 
-func (h *hardwareMetricsRepo) GetMetrics(w http.ResponseWriter, f http.Flusher, group string, lastTimestamp time.Time) time.Time {
+// GetMetrics returns metrics of host in chronological order, averaged per group
+// ("minute", "hour", "day", "month") or raw when group is "none". With a zero
+// since it returns the most recent batch, otherwise only what is newer than
+// since, so callers can poll with the timestamp of the last metric they got.
+func (h *hardwareMetricsRepo) GetMetrics(ctx context.Context, host, group string, since time.Time) ([]data.HardwareMetrics, error) {
 	var (
 		rows *sql.Rows
 		err  error
@@ -53,43 +94,32 @@ func (h *hardwareMetricsRepo) GetMetrics(w http.ResponseWriter, f http.Flusher,
 
 	switch group {
 	case "none":
-		if lastTimestamp.IsZero() {
-			// Initial raw batch: get latest N rows, then send in chronological order
+		if since.IsZero() {
+			// Initial raw batch: get latest N rows, then return them in chronological order
 			query := `
 				SELECT timestamp, cpu_percent, ram_percent, disk_percent
 				FROM (
 					SELECT timestamp, cpu_percent, ram_percent, disk_percent
 					FROM hardware_metrics
+					WHERE host = $2
 					ORDER BY timestamp DESC
 					LIMIT $1
 				) sub
 				ORDER BY timestamp ASC;
 			`
-			rows, err = h.db.Query(query, limit)
-			if err != nil {
-				slog.Error("Failed to query initial raw metrics", "error", err)
-				fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
-				f.Flush()
-				return lastTimestamp
-			}
+			rows, err = h.db.QueryContext(ctx, query, limit, host)
 		} else {
-			// Only rows newer than lastTimestamp (no limit; we'll send whatever new rows exist)
+			// Only rows newer than since (no limit; return whatever new rows exist)
 			query := `
 				SELECT timestamp, cpu_percent, ram_percent, disk_percent
 				FROM hardware_metrics
-				WHERE timestamp > $1
+				WHERE timestamp > $1 AND host = $2
 				ORDER BY timestamp ASC;
 			`
-			rows, err = h.db.Query(query, lastTimestamp)
-			if err != nil {
-				slog.Error("Failed to query new raw metrics", "error", err)
-				fmt.Fprintf(w, "event: error\ndata: %v\n\n", err)
-				f.Flush()
-				return lastTimestamp
-			}
+			rows, err = h.db.QueryContext(ctx, query, toLocal(since), host)
 		}
 	case "minute", "hour", "day", "month":
-		if lastTimestamp.IsZero() {
+		if since.IsZero() {
 			query := fmt.Sprintf(`
 				SELECT date_trunc('%s', timestamp) AS ts,
 					AVG(cpu_percent)::float8 AS cpu_percent,
@@ -98,21 +128,16 @@ func (h *hardwareMetricsRepo) GetMetrics(w http.ResponseWriter, f http.Flusher,
 				FROM (
 					SELECT timestamp, cpu_percent, ram_percent, disk_percent
 					FROM hardware_metrics
+					WHERE host = $2
 					ORDER BY timestamp DESC
 					LIMIT $1
 				) recent
 				GROUP BY ts
 				ORDER BY ts ASC;
 			`, group)
-
-			rows, err = h.db.Query(query, limit)
-			if err != nil {
-				slog.Error("Failed to query initial grouped metrics", "error", err)
-				http.Error(w, "Failed to query hardware metrics", http.StatusInternalServerError)
-				return lastTimestamp
-			}
+			rows, err = h.db.QueryContext(ctx, query, limit, host)
 		} else {
-			// Subsequent grouped query: aggregated groups with ts > lastTimestamp
+			// Subsequent grouped query: aggregated groups with ts > since
 			// Do aggregation in a subquery, then filter by ts in outer query.
 			query := fmt.Sprintf(`
 				SELECT ts, cpu_percent, ram_percent, disk_percent
@@ -123,83 +148,201 @@ func (h *hardwareMetricsRepo) GetMetrics(w http.ResponseWriter, f http.Flusher,
 						AVG(ram_percent)::float8 AS ram_percent,
 						AVG(disk_percent)::float8 AS disk_percent
 					FROM hardware_metrics
-					WHERE timestamp > $1
+					WHERE timestamp > $1 AND host = $2
 					GROUP BY ts_trunc
 				) sub
 				WHERE ts_trunc > $1
 				ORDER BY ts_trunc ASC;
 				`, group)
-
-			rows, err = h.db.Query(query, lastTimestamp)
-			if err != nil {
-				slog.Error("Failed to query new grouped metrics", "error", err)
-				return lastTimestamp
-			}
+			rows, err = h.db.QueryContext(ctx, query, toLocal(since), host)
 		}
+	default:
+		return nil, fmt.Errorf("unknown group %q", group)
 	}
+	if err != nil {
+		slog.Error("Failed to query metrics", "group", group, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
 
-	defer func() {
-		if rows != nil {
-			rows.Close()
-		}
-	}()
-
-	// Iterate and stream
-	newest := lastTimestamp
+	var metrics []data.HardwareMetrics
 	for rows.Next() {
 		var metric data.HardwareMetrics
 		if err := rows.Scan(&metric.Timestamp, &metric.CPUPercent, &metric.RAMPercent, &metric.DiskPercent); err != nil {
 			slog.Error("Failed to scan metric row", "error", err)
 			continue
 		}
-
-		// Send SSE event
-		sendMetric(w, f, metric)
-
-		if metric.Timestamp.After(newest) {
-			newest = metric.Timestamp
-		}
+		metric.Host = host
+		metric.Timestamp = asLocal(metric.Timestamp)
+		metrics = append(metrics, metric)
 	}
-
 	if err = rows.Err(); err != nil {
 		slog.Error("Error iterating metrics rows", "error", err)
+		return metrics, err
 	}
-
-	return newest
+	return metrics, nil
 }
 
-// sendMetric marshals metric and writes an SSE data: line and flushes.
-func sendMetric(w http.ResponseWriter, f http.Flusher, metric data.HardwareMetrics) {
-	b, err := json.Marshal(metric)
+func (h *hardwareMetricsRepo) QueryMetrics(ctx context.Context, q MetricsQuery) ([]data.HardwareMetrics, error) {
+	agg, ok := aggregations[q.Agg]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	// Buckets are aligned on the epoch so any step works, not only the
+	// units date_trunc knows about.
+	query := fmt.Sprintf(`
+		SELECT timestamp 'epoch' + floor(extract(epoch FROM timestamp) / $3) * $3 * interval '1 second' AS bucket,
+			(%s)::float8 AS cpu_percent,
+			(%s)::float8 AS ram_percent,
+			(%s)::float8 AS disk_percent
+		FROM %s
+		WHERE timestamp >= $1 AND timestamp < $2 AND host = $4
+		GROUP BY bucket
+		ORDER BY bucket ASC;`,
+		fmt.Sprintf(agg, "cpu_percent"), fmt.Sprintf(agg, "ram_percent"), fmt.Sprintf(agg, "disk_percent"),
+		tblHardwareMetrics)
+	rows, err := h.db.QueryContext(ctx, query, toLocal(q.From), toLocal(q.To), q.Step.Seconds(), q.Host)
 	if err != nil {
-		slog.Error("Failed to marshal metric", "error", err)
-		return
+		slog.Error("Failed to query aggregated metrics", "error", err)
+		return nil, err
 	}
-	fmt.Fprintf(w, "data: %s\n\n", b)
-	f.Flush()
+	defer rows.Close()
+	var metrics []data.HardwareMetrics
+	for rows.Next() {
+		var metric data.HardwareMetrics
+		if err := rows.Scan(&metric.Timestamp, &metric.CPUPercent, &metric.RAMPercent, &metric.DiskPercent); err != nil {
+			slog.Error("Failed to scan metric row", "error", err)
+			return nil, err
+		}
+		metric.Host = q.Host
+		metric.Timestamp = asLocal(metric.Timestamp)
+		metrics = append(metrics, metric)
+	}
+	return metrics, rows.Err()
 }
 
 func (m *hardwareMetricsRepo) InsertHardwareMetrics(ctx context.Context, s data.HardwareMetrics) error {
-	_, err := m.db.ExecContext(ctx, `
-		INSERT INTO `+tblHardwareMetrics+` (timestamp, cpu_percent, ram_percent, disk_percent) VALUES ($1, $2, $3, $4)`,
-		s.Timestamp, s.CPUPercent, s.RAMPercent, s.DiskPercent)
+	err := m.insertHardwareMetrics(ctx, s)
+	if err != nil {
+		telemetry.DBInsertErrors.Inc(tblHardwareMetrics)
+	}
 	return err
 }
 
+func (m *hardwareMetricsRepo) insertHardwareMetrics(ctx context.Context, s data.HardwareMetrics) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO `+tblHardwareMetrics+` (timestamp, host, cpu_percent, ram_percent, disk_percent) VALUES ($1, $2, $3, $4, $5)`,
+		toLocal(s.Timestamp), s.Host, s.CPUPercent, s.RAMPercent, s.DiskPercent); err != nil {
+		return err
+	}
+	if err := insertDiskMetrics(ctx, tx, s); err != nil {
+		return err
+	}
+	if err := insertSamples(ctx, tx, s); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetLatestMetrics returns the latest metrics of every host that reported
+// since since, including their disks and samples.
+func (h *hardwareMetricsRepo) GetLatestMetrics(ctx context.Context, since time.Time) ([]data.HardwareMetrics, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (host) host, timestamp, cpu_percent, ram_percent, disk_percent
+		FROM `+tblHardwareMetrics+`
+		WHERE timestamp > $1
+		ORDER BY host, timestamp DESC;`, toLocal(since))
+	if err != nil {
+		slog.Error("Failed to query latest metrics", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var metrics []data.HardwareMetrics
+	for rows.Next() {
+		var m data.HardwareMetrics
+		if err := rows.Scan(&m.Host, &m.Timestamp, &m.CPUPercent, &m.RAMPercent, &m.DiskPercent); err != nil {
+			return nil, err
+		}
+		m.Timestamp = asLocal(m.Timestamp)
+		metrics = append(metrics, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Disks and samples are stored with the timestamp of their collection.
+	for i := range metrics {
+		m := &metrics[i]
+		if m.Disks, err = h.disksAt(ctx, m.Host, m.Timestamp); err != nil {
+			return nil, err
+		}
+		if m.Samples, err = h.samplesAt(ctx, m.Host, m.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+// ListHosts returns the hosts that reported metrics since since.
+func (h *hardwareMetricsRepo) ListHosts(ctx context.Context, since time.Time) ([]string, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT DISTINCT host FROM `+tblHardwareMetrics+`
+		WHERE timestamp > $1 AND host <> ''
+		ORDER BY host;`, toLocal(since))
+	if err != nil {
+		slog.Error("Failed to query hosts", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	hosts := []string{}
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, rows.Err()
+}
+
+// ClaimUnassigned assigns metrics recorded before hosts existed to host.
+func (h *hardwareMetricsRepo) ClaimUnassigned(ctx context.Context, host string) error {
+	for _, table := range []string{tblHardwareMetrics, tblDiskMetrics, tblMetricSamples} {
+		if _, err := h.db.ExecContext(ctx, `UPDATE `+table+` SET host = $1 WHERE host = ''`, host); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return nil
+}
+
 func (m *hardwareMetricsRepo) CreateTableIfNotExists(ctx context.Context) {
 	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			id SERIAL PRIMARY KEY,
 			timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			cpu_percent FLOAT NOT NULL,
-			ram_percent FLOAT NOT NULL,
-			disk_percent FLOAT NOT NULL
+			cpu_percent FLOAT,
+			ram_percent FLOAT,
+			disk_percent FLOAT
 		);
+		-- host was added with agents, rows from before belong to ''.
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT '';
+		-- Metrics that could not be collected are stored as NULL.
+		ALTER TABLE %s ALTER COLUMN cpu_percent DROP NOT NULL,
+			ALTER COLUMN ram_percent DROP NOT NULL,
+			ALTER COLUMN disk_percent DROP NOT NULL;
 		CREATE INDEX IF NOT EXISTS idx_hardware_metrics_timestamp_desc ON %s (timestamp DESC);
+		CREATE INDEX IF NOT EXISTS idx_hardware_metrics_host_timestamp ON %s (host, timestamp DESC);
 		COMMENT ON TABLE %s IS 'Stores hardware metrics on homelab';
 		GRANT ALL ON %s TO minator;
 		GRANT USAGE, SELECT ON SEQUENCE hardware_metrics_id_seq TO minator;`,
-		tblHardwareMetrics, tblHardwareMetrics, tblHardwareMetrics, tblHardwareMetrics)); err != nil {
+		tblHardwareMetrics, tblHardwareMetrics, tblHardwareMetrics, tblHardwareMetrics, tblHardwareMetrics,
+		tblHardwareMetrics, tblHardwareMetrics)); err != nil {
 		slog.Error("Failed to create table", "tableName", tblHardwareMetrics, "error", err)
 	}
+	m.createDiskTableIfNotExists(ctx)
+	m.createSampleTableIfNotExists(ctx)
 }
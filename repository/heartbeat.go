@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"time"
+)
+
+const tblHeartbeats = "heartbeats"
+
+type HeartbeatRepo interface {
+	// UpsertHeartbeat creates hb or updates its interval and expected
+	// status. pingTokenHash is only stored when the heartbeat is created,
+	// the returned bool tells whether that happened.
+	UpsertHeartbeat(ctx context.Context, hb data.Heartbeat, pingTokenHash string) (data.Heartbeat, bool, error)
+	GetHeartbeats(ctx context.Context) ([]data.Heartbeat, error)
+	GetHeartbeatByToken(ctx context.Context, pingTokenHash string) (data.Heartbeat, error)
+	DeleteHeartbeat(ctx context.Context, name string) error
+	CreateTableIfNotExists(ctx context.Context)
+}
+
+type heartbeatRepo struct {
+	db *sql.DB
+}
+
+func NewHeartbeatRepo(db *sql.DB) HeartbeatRepo {
+	return &heartbeatRepo{db: db}
+}
+
+func (m *heartbeatRepo) UpsertHeartbeat(ctx context.Context, hb data.Heartbeat, pingTokenHash string) (data.Heartbeat, bool, error) {
+	var created bool
+	err := m.db.QueryRowContext(ctx, `
+		INSERT INTO `+tblHeartbeats+` (name, interval_seconds, expect_status, ping_token_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE
+		SET interval_seconds = EXCLUDED.interval_seconds, expect_status = EXCLUDED.expect_status
+		RETURNING created_at, (xmax = 0)`,
+		hb.Name, int64(hb.Interval.Seconds()), hb.ExpectStatus, pingTokenHash, toLocal(time.Now())).Scan(&hb.CreatedAt, &created)
+	hb.CreatedAt = asLocal(hb.CreatedAt)
+	return hb, created, err
+}
+
+// heartbeatColumns selects a heartbeat along with the last time its
+// expected status was reported, whichever way it came in. Anything recorded
+// during maintenance counts too, so a job gets a full interval once the
+// window is over.
+const heartbeatColumns = `
+	h.name, h.interval_seconds, h.expect_status, h.created_at,
+	(SELECT MAX(s.timestamp) FROM ` + TblServiceStatus + ` s
+		WHERE s.name = h.name AND s.status IN (h.expect_status, '` + data.StatusMaintenance + `')) AS last_seen`
+
+func (m *heartbeatRepo) GetHeartbeats(ctx context.Context) ([]data.Heartbeat, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+heartbeatColumns+`
+		FROM `+tblHeartbeats+` h
+		ORDER BY h.name;`)
+	if err != nil {
+		slog.Error("Failed to query heartbeats", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var heartbeats []data.Heartbeat
+	for rows.Next() {
+		hb, err := scanHeartbeat(rows)
+		if err != nil {
+			slog.Error("Failed to scan heartbeat", "error", err)
+			return nil, err
+		}
+		heartbeats = append(heartbeats, hb)
+	}
+	return heartbeats, rows.Err()
+}
+
+func (m *heartbeatRepo) GetHeartbeatByToken(ctx context.Context, pingTokenHash string) (data.Heartbeat, error) {
+	hb, err := scanHeartbeat(m.db.QueryRowContext(ctx, `
+		SELECT `+heartbeatColumns+`
+		FROM `+tblHeartbeats+` h
+		WHERE h.ping_token_hash = $1`,
+		pingTokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return hb, ErrNotFound
+	}
+	return hb, err
+}
+
+func (m *heartbeatRepo) DeleteHeartbeat(ctx context.Context, name string) error {
+	res, err := m.db.ExecContext(ctx, `DELETE FROM `+tblHeartbeats+` WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanHeartbeat(row scanner) (data.Heartbeat, error) {
+	var (
+		hb       data.Heartbeat
+		seconds  int64
+		lastSeen sql.NullTime
+	)
+	if err := row.Scan(&hb.Name, &seconds, &hb.ExpectStatus, &hb.CreatedAt, &lastSeen); err != nil {
+		return hb, err
+	}
+	hb.Interval = time.Duration(seconds) * time.Second
+	hb.CreatedAt = asLocal(hb.CreatedAt)
+	hb.LastSeen = nullTime(lastSeen)
+	return hb, nil
+}
+
+func (m *heartbeatRepo) CreateTableIfNotExists(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			name VARCHAR(255) PRIMARY KEY,
+			interval_seconds BIGINT NOT NULL,
+			expect_status VARCHAR(50) NOT NULL,
+			ping_token_hash CHAR(64) NOT NULL UNIQUE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		COMMENT ON TABLE %s IS 'Stores expected heartbeats of push-reporting jobs';
+		GRANT ALL ON %s TO minator;`,
+		tblHeartbeats, tblHeartbeats, tblHeartbeats)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblHeartbeats, "error", err)
+	}
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	tblIncidents       = "incidents"
+	tblIncidentUpdates = "incident_updates"
+)
+
+// IncidentRepo stores the incident notes of the public status page.
+type IncidentRepo interface {
+	CreateIncident(ctx context.Context, i data.Incident) (data.Incident, error)
+	AddIncidentUpdate(ctx context.Context, id int64, u data.IncidentUpdate) (data.IncidentUpdate, error)
+	// ResolveIncident marks incident id as resolved at at, unless it
+	// already was.
+	ResolveIncident(ctx context.Context, id int64, at time.Time) error
+	// GetIncident returns incident id with its updates.
+	GetIncident(ctx context.Context, id int64) (data.Incident, error)
+	// ListIncidents returns the incidents that are open or were resolved
+	// after since, with their updates, newest first.
+	ListIncidents(ctx context.Context, since time.Time) ([]data.Incident, error)
+	DeleteIncident(ctx context.Context, id int64) error
+	CreateTableIfNotExists(ctx context.Context)
+}
+
+type incidentRepo struct {
+	db *sql.DB
+}
+
+func NewIncidentRepo(db *sql.DB) IncidentRepo {
+	return &incidentRepo{db: db}
+}
+
+func (m *incidentRepo) CreateIncident(ctx context.Context, i data.Incident) (data.Incident, error) {
+	i.CreatedAt = time.Now()
+	err := m.db.QueryRowContext(ctx, `
+		INSERT INTO `+tblIncidents+` (title, body, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		i.Title, i.Body, toLocal(i.CreatedAt)).Scan(&i.ID)
+	i.Updates = []data.IncidentUpdate{}
+	return i, err
+}
+
+func (m *incidentRepo) AddIncidentUpdate(ctx context.Context, id int64, u data.IncidentUpdate) (data.IncidentUpdate, error) {
+	u.CreatedAt = time.Now()
+	err := m.db.QueryRowContext(ctx, `
+		INSERT INTO `+tblIncidentUpdates+` (incident_id, body, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		id, u.Body, toLocal(u.CreatedAt)).Scan(&u.ID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+		return u, ErrNotFound
+	}
+	return u, err
+}
+
+func (m *incidentRepo) ResolveIncident(ctx context.Context, id int64, at time.Time) error {
+	res, err := m.db.ExecContext(ctx, `
+		UPDATE `+tblIncidents+` SET resolved_at = COALESCE(resolved_at, $2)
+		WHERE id = $1`,
+		id, toLocal(at))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const incidentColumns = `id, title, body, created_at, resolved_at`
+
+func (m *incidentRepo) GetIncident(ctx context.Context, id int64) (data.Incident, error) {
+	i, err := scanIncident(m.db.QueryRowContext(ctx, `
+		SELECT `+incidentColumns+`
+		FROM `+tblIncidents+`
+		WHERE id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return i, ErrNotFound
+	}
+	if err != nil {
+		return i, err
+	}
+	incidents := []data.Incident{i}
+	if err := m.loadUpdates(ctx, incidents); err != nil {
+		return i, err
+	}
+	return incidents[0], nil
+}
+
+func (m *incidentRepo) ListIncidents(ctx context.Context, since time.Time) ([]data.Incident, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+incidentColumns+`
+		FROM `+tblIncidents+`
+		WHERE resolved_at IS NULL OR resolved_at > $1
+		ORDER BY created_at DESC, id DESC;`,
+		toLocal(since))
+	if err != nil {
+		slog.Error("Failed to query incidents", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var incidents []data.Incident
+	for rows.Next() {
+		i, err := scanIncident(rows)
+		if err != nil {
+			slog.Error("Failed to scan incident", "error", err)
+			return nil, err
+		}
+		incidents = append(incidents, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return incidents, m.loadUpdates(ctx, incidents)
+}
+
+// loadUpdates fills in the updates of incidents in a single query.
+func (m *incidentRepo) loadUpdates(ctx context.Context, incidents []data.Incident) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(incidents))
+	byID := make(map[int64]*data.Incident, len(incidents))
+	for n := range incidents {
+		incidents[n].Updates = []data.IncidentUpdate{}
+		ids[n] = incidents[n].ID
+		byID[incidents[n].ID] = &incidents[n]
+	}
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT incident_id, id, body, created_at
+		FROM `+tblIncidentUpdates+`
+		WHERE incident_id = ANY($1)
+		ORDER BY created_at, id;`,
+		pq.Array(ids))
+	if err != nil {
+		slog.Error("Failed to query incident updates", "error", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			incidentID int64
+			u          data.IncidentUpdate
+		)
+		if err := rows.Scan(&incidentID, &u.ID, &u.Body, &u.CreatedAt); err != nil {
+			slog.Error("Failed to scan incident update", "error", err)
+			return err
+		}
+		u.CreatedAt = asLocal(u.CreatedAt)
+		i := byID[incidentID]
+		i.Updates = append(i.Updates, u)
+	}
+	return rows.Err()
+}
+
+func (m *incidentRepo) DeleteIncident(ctx context.Context, id int64) error {
+	res, err := m.db.ExecContext(ctx, `DELETE FROM `+tblIncidents+` WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanIncident(row scanner) (data.Incident, error) {
+	var (
+		i          data.Incident
+		resolvedAt sql.NullTime
+	)
+	if err := row.Scan(&i.ID, &i.Title, &i.Body, &i.CreatedAt, &resolvedAt); err != nil {
+		return i, err
+	}
+	i.CreatedAt = asLocal(i.CreatedAt)
+	i.ResolvedAt = nullTime(resolvedAt)
+	return i, nil
+}
+
+func (m *incidentRepo) CreateTableIfNotExists(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			title VARCHAR(255) NOT NULL,
+			body TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			resolved_at TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			incident_id INT NOT NULL REFERENCES %s (id) ON DELETE CASCADE,
+			body TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_incident_updates_incident_id ON %s (incident_id);
+		COMMENT ON TABLE %s IS 'Stores incident notes of the public status page';
+		COMMENT ON TABLE %s IS 'Stores follow-ups on incidents';
+		GRANT ALL ON %s, %s TO minator;
+		GRANT USAGE, SELECT ON SEQUENCE incidents_id_seq, incident_updates_id_seq TO minator;`,
+		tblIncidents, tblIncidentUpdates, tblIncidents, tblIncidentUpdates,
+		tblIncidents, tblIncidentUpdates, tblIncidents, tblIncidentUpdates)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblIncidents, "error", err)
+	}
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+
+	"github.com/lib/pq"
+)
+
+const tblJobRuns = "job_runs"
+
+type JobRunRepo interface {
+	// StartRun stores a new run, ErrExists means job already has a run
+	// with that ID.
+	StartRun(ctx context.Context, run data.JobRun) error
+	// UpdateRun loads a run, applies update and stores the result, all
+	// within one transaction so concurrent updates don't get lost.
+	UpdateRun(ctx context.Context, job, id string, update func(*data.JobRun) error) (data.JobRun, error)
+	// GetRecentRuns returns the latest runs, of job only unless it is empty.
+	GetRecentRuns(ctx context.Context, job string, limit int) ([]data.JobRun, error)
+	CreateTableIfNotExists(ctx context.Context)
+}
+
+type jobRunRepo struct {
+	db *sql.DB
+}
+
+func NewJobRunRepo(db *sql.DB) JobRunRepo {
+	return &jobRunRepo{db: db}
+}
+
+const jobRunColumns = `id, job, status, started_at, finished_at, exit_code, bytes, size_bytes, message, steps`
+
+func (m *jobRunRepo) StartRun(ctx context.Context, run data.JobRun) error {
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = m.db.ExecContext(ctx, `
+		INSERT INTO `+tblJobRuns+` (`+jobRunColumns+`)
+		VALUES ($1, $2, $3, $4, NULL, NULL, $5, $6, $7, $8)`,
+		run.ID, run.Job, run.Status, toLocal(run.StartedAt), run.Bytes, run.SizeBytes, run.Message, steps)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return ErrExists
+	}
+	return err
+}
+
+func (m *jobRunRepo) UpdateRun(ctx context.Context, job, id string, update func(*data.JobRun) error) (data.JobRun, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return data.JobRun{}, err
+	}
+	defer tx.Rollback()
+	run, err := scanJobRun(tx.QueryRowContext(ctx, `
+		SELECT `+jobRunColumns+`
+		FROM `+tblJobRuns+`
+		WHERE job = $1 AND id = $2
+		FOR UPDATE`,
+		job, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, ErrNotFound
+	}
+	if err != nil {
+		return run, err
+	}
+	if err := update(&run); err != nil {
+		return run, err
+	}
+	steps, err := json.Marshal(run.Steps)
+	if err != nil {
+		return run, err
+	}
+	var finishedAt any
+	if run.FinishedAt != nil {
+		finishedAt = toLocal(*run.FinishedAt)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE `+tblJobRuns+`
+		SET status = $3, finished_at = $4, exit_code = $5, bytes = $6, size_bytes = $7, message = $8, steps = $9
+		WHERE job = $1 AND id = $2`,
+		job, id, run.Status, finishedAt, run.ExitCode, run.Bytes, run.SizeBytes, run.Message, steps); err != nil {
+		return run, err
+	}
+	return run, tx.Commit()
+}
+
+func (m *jobRunRepo) GetRecentRuns(ctx context.Context, job string, limit int) ([]data.JobRun, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+jobRunColumns+`
+		FROM `+tblJobRuns+`
+		WHERE $1 = '' OR job = $1
+		ORDER BY started_at DESC
+		LIMIT $2`,
+		job, limit)
+	if err != nil {
+		slog.Error("Failed to query job runs", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []data.JobRun
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			slog.Error("Failed to scan job run", "error", err)
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func scanJobRun(row scanner) (data.JobRun, error) {
+	var (
+		run        data.JobRun
+		finishedAt sql.NullTime
+		exitCode   sql.NullInt64
+		bytes      sql.NullInt64
+		sizeBytes  sql.NullInt64
+		steps      []byte
+	)
+	if err := row.Scan(&run.ID, &run.Job, &run.Status, &run.StartedAt, &finishedAt,
+		&exitCode, &bytes, &sizeBytes, &run.Message, &steps); err != nil {
+		return run, err
+	}
+	run.StartedAt = asLocal(run.StartedAt)
+	run.FinishedAt = nullTime(finishedAt)
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		run.ExitCode = &code
+	}
+	if bytes.Valid {
+		run.Bytes = &bytes.Int64
+	}
+	if sizeBytes.Valid {
+		run.SizeBytes = &sizeBytes.Int64
+	}
+	if err := json.Unmarshal(steps, &run.Steps); err != nil {
+		return run, fmt.Errorf("invalid steps of run %s: %v", run.ID, err)
+	}
+	return run, nil
+}
+
+func (m *jobRunRepo) CreateTableIfNotExists(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(64) NOT NULL,
+			job VARCHAR(255) NOT NULL,
+			status VARCHAR(50) NOT NULL,
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP,
+			exit_code INTEGER,
+			bytes BIGINT,
+			size_bytes BIGINT,
+			message TEXT NOT NULL DEFAULT '',
+			steps JSONB NOT NULL DEFAULT '[]',
+			PRIMARY KEY (job, id)
+		);
+		-- Run IDs used to be unique across jobs, they only are per job now.
+		DO $$
+		BEGIN
+			IF (SELECT COUNT(*) FROM pg_constraint c
+				JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY(c.conkey)
+				WHERE c.conname = '%s_pkey') = 1 THEN
+				ALTER TABLE %s DROP CONSTRAINT %s_pkey, ADD PRIMARY KEY (job, id);
+			END IF;
+		END $$;
+		CREATE INDEX IF NOT EXISTS idx_job_runs_job_started_at ON %s (job, started_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_job_runs_started_at ON %s (started_at DESC);
+		COMMENT ON TABLE %s IS 'Stores runs of jobs like backups';
+		GRANT ALL ON %s TO minator;`,
+		tblJobRuns, tblJobRuns, tblJobRuns, tblJobRuns,
+		tblJobRuns, tblJobRuns, tblJobRuns, tblJobRuns)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblJobRuns, "error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const tblMaintenance = "maintenance_windows"
+
+type MaintenanceRepo interface {
+	CreateMaintenance(ctx context.Context, mw data.Maintenance) (data.Maintenance, error)
+	// ListMaintenance returns every window that still has an occurrence
+	// ending after since, oldest first.
+	ListMaintenance(ctx context.Context, since time.Time) ([]data.Maintenance, error)
+	GetMaintenance(ctx context.Context, id int64) (data.Maintenance, error)
+	DeleteMaintenance(ctx context.Context, id int64) error
+	CreateTableIfNotExists(ctx context.Context)
+}
+
+type maintenanceRepo struct {
+	db *sql.DB
+}
+
+func NewMaintenanceRepo(db *sql.DB) MaintenanceRepo {
+	return &maintenanceRepo{db: db}
+}
+
+func (m *maintenanceRepo) CreateMaintenance(ctx context.Context, mw data.Maintenance) (data.Maintenance, error) {
+	mw.CreatedAt = time.Now()
+	var until any
+	if mw.Until != nil {
+		until = toLocal(*mw.Until)
+	}
+	err := m.db.QueryRowContext(ctx, `
+		INSERT INTO `+tblMaintenance+` (kind, title, services, starts_at, duration_seconds, repeat_seconds, until, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		mw.Kind, mw.Title, pq.Array(mw.Services), toLocal(mw.StartsAt), int64(mw.Duration.Seconds()),
+		int64(mw.Repeat.Seconds()), until, toLocal(mw.CreatedAt)).Scan(&mw.ID)
+	return mw, err
+}
+
+const maintenanceColumns = `id, kind, title, services, starts_at, duration_seconds, repeat_seconds, until, created_at`
+
+func (m *maintenanceRepo) ListMaintenance(ctx context.Context, since time.Time) ([]data.Maintenance, error) {
+	// Recurring windows last until their until, one-off windows until they
+	// end.
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+maintenanceColumns+`
+		FROM `+tblMaintenance+`
+		WHERE CASE WHEN repeat_seconds > 0
+			THEN until IS NULL OR until + make_interval(secs => duration_seconds) > $1
+			ELSE starts_at + make_interval(secs => duration_seconds) > $1
+		END
+		ORDER BY starts_at, id;`,
+		toLocal(since))
+	if err != nil {
+		slog.Error("Failed to query maintenance windows", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var windows []data.Maintenance
+	for rows.Next() {
+		mw, err := scanMaintenance(rows)
+		if err != nil {
+			slog.Error("Failed to scan maintenance window", "error", err)
+			return nil, err
+		}
+		windows = append(windows, mw)
+	}
+	return windows, rows.Err()
+}
+
+func (m *maintenanceRepo) GetMaintenance(ctx context.Context, id int64) (data.Maintenance, error) {
+	mw, err := scanMaintenance(m.db.QueryRowContext(ctx, `
+		SELECT `+maintenanceColumns+`
+		FROM `+tblMaintenance+`
+		WHERE id = $1`,
+		id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return mw, ErrNotFound
+	}
+	return mw, err
+}
+
+func (m *maintenanceRepo) DeleteMaintenance(ctx context.Context, id int64) error {
+	res, err := m.db.ExecContext(ctx, `DELETE FROM `+tblMaintenance+` WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanMaintenance(row scanner) (data.Maintenance, error) {
+	var (
+		mw              data.Maintenance
+		duration, every int64
+		until           sql.NullTime
+	)
+	if err := row.Scan(&mw.ID, &mw.Kind, &mw.Title, pq.Array(&mw.Services), &mw.StartsAt,
+		&duration, &every, &until, &mw.CreatedAt); err != nil {
+		return mw, err
+	}
+	mw.StartsAt = asLocal(mw.StartsAt)
+	mw.Duration = time.Duration(duration) * time.Second
+	mw.Repeat = time.Duration(every) * time.Second
+	mw.Until = nullTime(until)
+	mw.CreatedAt = asLocal(mw.CreatedAt)
+	return mw, nil
+}
+
+func (m *maintenanceRepo) CreateTableIfNotExists(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id SERIAL PRIMARY KEY,
+			kind VARCHAR(20) NOT NULL,
+			title VARCHAR(255) NOT NULL DEFAULT '',
+			services TEXT[] NOT NULL,
+			starts_at TIMESTAMP NOT NULL,
+			duration_seconds BIGINT NOT NULL,
+			repeat_seconds BIGINT NOT NULL DEFAULT 0,
+			until TIMESTAMP,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		COMMENT ON TABLE %s IS 'Stores maintenance windows and alert silences';
+		GRANT ALL ON %s TO minator;
+		GRANT USAGE, SELECT ON SEQUENCE maintenance_windows_id_seq TO minator;`,
+		tblMaintenance, tblMaintenance, tblMaintenance)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblMaintenance, "error", err)
+	}
+}
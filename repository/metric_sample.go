@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"minator/data"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const tblMetricSamples = "metric_samples"
+
+// insertSamples stores the samples of s, sharing its timestamp.
+func insertSamples(ctx context.Context, tx *sql.Tx, s data.HardwareMetrics) error {
+	if len(s.Samples) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO `+tblMetricSamples+` (timestamp, host, name, labels, value) VALUES ($1, $2, $3, $4, $5)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, sample := range s.Samples {
+		labels, err := json.Marshal(sample.Labels)
+		if err != nil {
+			return err
+		}
+		if sample.Labels == nil {
+			labels = []byte("{}")
+		}
+		if _, err := stmt.ExecContext(ctx, toLocal(s.Timestamp), s.Host, sample.Name, labels, sample.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuerySamples returns one series per name and label set between q.From and
+// q.To, aggregated like QueryMetrics. An empty names returns every metric.
+func (h *hardwareMetricsRepo) QuerySamples(ctx context.Context, q MetricsQuery, names []string) ([]data.SampleSeries, error) {
+	agg, ok := aggregations[q.Agg]
+	if !ok {
+		return nil, fmt.Errorf("unknown aggregation %q", q.Agg)
+	}
+	query := fmt.Sprintf(`
+		SELECT name, labels,
+			timestamp 'epoch' + floor(extract(epoch FROM timestamp) / $3) * $3 * interval '1 second' AS bucket,
+			(%s)::float8 AS value
+		FROM %s
+		WHERE timestamp >= $1 AND timestamp < $2 AND host = $5
+			AND (cardinality($4::text[]) = 0 OR name = ANY($4))
+		GROUP BY name, labels, bucket
+		ORDER BY name, labels, bucket ASC;`,
+		fmt.Sprintf(agg, "value"), tblMetricSamples)
+	if names == nil {
+		names = []string{}
+	}
+	rows, err := h.db.QueryContext(ctx, query, toLocal(q.From), toLocal(q.To), q.Step.Seconds(), pq.Array(names), q.Host)
+	if err != nil {
+		slog.Error("Failed to query metric samples", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []data.SampleSeries{}
+	lastKey := ""
+	for rows.Next() {
+		var (
+			name   string
+			labels []byte
+			p      data.SamplePoint
+		)
+		if err := rows.Scan(&name, &labels, &p.Timestamp, &p.Value); err != nil {
+			slog.Error("Failed to scan metric sample row", "error", err)
+			return nil, err
+		}
+		p.Timestamp = asLocal(p.Timestamp)
+		var l map[string]string
+		if err := json.Unmarshal(labels, &l); err != nil {
+			return nil, err
+		}
+		// Rows are ordered by series, so a new key starts a new series.
+		if key := data.SeriesKey(name, l); key != lastKey || len(series) == 0 {
+			series = append(series, data.SampleSeries{Name: name, Labels: l})
+			lastKey = key
+		}
+		s := &series[len(series)-1]
+		s.Points = append(s.Points, p)
+	}
+	return series, rows.Err()
+}
+
+// samplesAt returns the samples of host collected at ts.
+func (h *hardwareMetricsRepo) samplesAt(ctx context.Context, host string, ts time.Time) ([]data.Sample, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT name, labels, value
+		FROM `+tblMetricSamples+`
+		WHERE host = $1 AND timestamp = $2
+		ORDER BY name;`, host, toLocal(ts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var samples []data.Sample
+	for rows.Next() {
+		var (
+			s      data.Sample
+			labels []byte
+		)
+		if err := rows.Scan(&s.Name, &labels, &s.Value); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(labels, &s.Labels); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+func (h *hardwareMetricsRepo) createSampleTableIfNotExists(ctx context.Context) {
+	if _, err := h.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			name TEXT NOT NULL,
+			labels JSONB NOT NULL DEFAULT '{}',
+			value FLOAT NOT NULL
+		);
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_metric_samples_name_timestamp ON %s (name, timestamp DESC);
+		CREATE INDEX IF NOT EXISTS idx_metric_samples_host_name_timestamp ON %s (host, name, timestamp);
+		CREATE INDEX IF NOT EXISTS idx_metric_samples_timestamp ON %s (timestamp);
+		COMMENT ON TABLE %s IS 'Stores labelled host metrics (load, swap, network, disk I/O, temperatures)';
+		GRANT ALL ON %s TO minator;
+		GRANT USAGE, SELECT ON SEQUENCE metric_samples_id_seq TO minator;`,
+		tblMetricSamples, tblMetricSamples, tblMetricSamples, tblMetricSamples, tblMetricSamples, tblMetricSamples, tblMetricSamples)); err != nil {
+		slog.Error("Failed to create table", "tableName", tblMetricSamples, "error", err)
+	}
+}
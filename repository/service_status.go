@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"log/slog"
 	"minator/data"
+	"minator/telemetry"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 const TblServiceStatus = "service_status"
@@ -13,9 +18,31 @@ const TblServiceStatus = "service_status"
 type ServiceStatusRepo interface {
 	InsertServiceStatus(ctx context.Context, statuses []data.ServiceStatus) error
 	GetLatestServiceStatus(ctx context.Context) ([]data.ServiceStatus, error)
+	// GetLatestServiceStatusByName returns the latest status of each of
+	// names that has any, keyed by name.
+	GetLatestServiceStatusByName(ctx context.Context, names []string) (map[string]data.ServiceStatus, error)
+	GetServiceStatusRange(ctx context.Context, name string, from, to time.Time) ([]data.ServiceStatus, error)
+	GetServiceStatusHistory(ctx context.Context, q StatusHistoryQuery) ([]data.ServiceStatus, error)
+	// GetStatusTransitions returns, for every service, the first status
+	// recorded between from and to and each later change of status, in
+	// chronological order and at most limit of them.
+	GetStatusTransitions(ctx context.Context, from, to time.Time, limit int) ([]data.ServiceStatus, error)
 	CreateTableIfNotExists(ctx context.Context)
 }
 
+// StatusHistoryQuery selects one page of a service's history, newest first.
+type StatusHistoryQuery struct {
+	Name     string
+	From     time.Time
+	To       time.Time
+	Statuses []string // empty means any status
+	Limit    int
+	// BeforeTimestamp and BeforeID continue a previous page: only rows
+	// strictly older than this (timestamp, id) pair are returned.
+	BeforeTimestamp time.Time
+	BeforeID        int64
+}
+
 type serviceStatusRepo struct {
 	db *sql.DB
 }
@@ -26,22 +53,33 @@ func NewServiceStatusRepo(db *sql.DB) ServiceStatusRepo {
 	}
 }
 
+// InsertServiceStatus stores statuses in a single transaction and sets the
+// ID of each of them.
 func (m *serviceStatusRepo) InsertServiceStatus(ctx context.Context, statuses []data.ServiceStatus) error {
-	tx, err := m.db.Begin()
+	err := m.insertServiceStatus(ctx, statuses)
+	if err != nil {
+		telemetry.DBInsertErrors.Inc(TblServiceStatus)
+	}
+	return err
+}
+
+func (m *serviceStatusRepo) insertServiceStatus(ctx context.Context, statuses []data.ServiceStatus) error {
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 	stmt, err := tx.Prepare(fmt.Sprintf(`
-		INSERT INTO %s (timestamp, name, status, detail)
-		VALUES ($1, $2, $3, $4)`,
+		INSERT INTO %s (timestamp, host, name, status, detail)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
 		TblServiceStatus))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	for _, s := range statuses {
-		if _, err := stmt.ExecContext(ctx, s.Timestamp, s.Name, s.Status, s.Detail); err != nil {
+	for i, s := range statuses {
+		if err := stmt.QueryRowContext(ctx, toLocal(s.Timestamp), s.Host, s.Name, s.Status, s.Detail).Scan(&statuses[i].ID); err != nil {
 			return err
 		}
 	}
@@ -55,7 +93,7 @@ func (m *serviceStatusRepo) GetLatestServiceStatus(ctx context.Context) ([]data.
 			FROM `+TblServiceStatus+`
 			GROUP BY name
 		)
-		SELECT m.name, m.status, m.detail, m.timestamp
+		SELECT m.id, m.host, m.name, m.status, m.detail, m.timestamp
 		FROM `+TblServiceStatus+` m
 		INNER JOIN LatestStatus ls ON m.name = ls.name AND m.timestamp = ls.max_timestamp
 		ORDER BY m.name;`)
@@ -67,15 +105,143 @@ func (m *serviceStatusRepo) GetLatestServiceStatus(ctx context.Context) ([]data.
 	var statuses []data.ServiceStatus
 	for rows.Next() {
 		var s data.ServiceStatus
-		if err := rows.Scan(&s.Name, &s.Status, &s.Detail, &s.Timestamp); err != nil {
+		if err := rows.Scan(&s.ID, &s.Host, &s.Name, &s.Status, &s.Detail, &s.Timestamp); err != nil {
 			slog.Error("Failed to scan service status", "error", err)
 			return nil, err
 		}
+		s.Timestamp = asLocal(s.Timestamp)
 		statuses = append(statuses, s)
 	}
 	return statuses, nil
 }
 
+func (m *serviceStatusRepo) GetLatestServiceStatusByName(ctx context.Context, names []string) (map[string]data.ServiceStatus, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (name) id, host, name, status, detail, timestamp
+		FROM `+TblServiceStatus+`
+		WHERE name = ANY($1)
+		ORDER BY name, timestamp DESC, id DESC;`,
+		pq.Array(names))
+	if err != nil {
+		slog.Error("Failed to query latest service status", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	latest := make(map[string]data.ServiceStatus, len(names))
+	for rows.Next() {
+		var s data.ServiceStatus
+		if err := rows.Scan(&s.ID, &s.Host, &s.Name, &s.Status, &s.Detail, &s.Timestamp); err != nil {
+			slog.Error("Failed to scan service status", "error", err)
+			return nil, err
+		}
+		s.Timestamp = asLocal(s.Timestamp)
+		latest[s.Name] = s
+	}
+	return latest, rows.Err()
+}
+
+// GetServiceStatusRange returns the statuses of name between from and to in
+// chronological order. The last status recorded before from is included as
+// well so callers know the state the service was in when the range starts.
+func (m *serviceStatusRepo) GetServiceStatusRange(ctx context.Context, name string, from, to time.Time) ([]data.ServiceStatus, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		(SELECT host, name, status, detail, timestamp
+		FROM `+TblServiceStatus+`
+		WHERE name = $1 AND timestamp < $2
+		ORDER BY timestamp DESC
+		LIMIT 1)
+		UNION ALL
+		(SELECT host, name, status, detail, timestamp
+		FROM `+TblServiceStatus+`
+		WHERE name = $1 AND timestamp >= $2 AND timestamp <= $3)
+		ORDER BY timestamp ASC;`,
+		name, toLocal(from), toLocal(to))
+	if err != nil {
+		slog.Error("Failed to query service status range", "name", name, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var statuses []data.ServiceStatus
+	for rows.Next() {
+		var s data.ServiceStatus
+		if err := rows.Scan(&s.Host, &s.Name, &s.Status, &s.Detail, &s.Timestamp); err != nil {
+			slog.Error("Failed to scan service status", "error", err)
+			return nil, err
+		}
+		s.Timestamp = asLocal(s.Timestamp)
+		statuses = append(statuses, s)
+	}
+	return statuses, rows.Err()
+}
+
+func (m *serviceStatusRepo) GetServiceStatusHistory(ctx context.Context, q StatusHistoryQuery) ([]data.ServiceStatus, error) {
+	where := []string{"name = $1", "timestamp >= $2", "timestamp <= $3"}
+	args := []any{q.Name, toLocal(q.From), toLocal(q.To)}
+	if len(q.Statuses) > 0 {
+		args = append(args, pq.Array(q.Statuses))
+		where = append(where, fmt.Sprintf("status = ANY($%d)", len(args)))
+	}
+	if !q.BeforeTimestamp.IsZero() {
+		args = append(args, toLocal(q.BeforeTimestamp), q.BeforeID)
+		where = append(where, fmt.Sprintf("(timestamp, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, q.Limit)
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, host, name, status, detail, timestamp
+		FROM %s
+		WHERE %s
+		ORDER BY timestamp DESC, id DESC
+		LIMIT $%d;`,
+		TblServiceStatus, strings.Join(where, " AND "), len(args)), args...)
+	if err != nil {
+		slog.Error("Failed to query service status history", "name", q.Name, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var statuses []data.ServiceStatus
+	for rows.Next() {
+		var s data.ServiceStatus
+		if err := rows.Scan(&s.ID, &s.Host, &s.Name, &s.Status, &s.Detail, &s.Timestamp); err != nil {
+			slog.Error("Failed to scan service status", "error", err)
+			return nil, err
+		}
+		s.Timestamp = asLocal(s.Timestamp)
+		statuses = append(statuses, s)
+	}
+	return statuses, rows.Err()
+}
+
+func (m *serviceStatusRepo) GetStatusTransitions(ctx context.Context, from, to time.Time, limit int) ([]data.ServiceStatus, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT id, host, name, status, detail, timestamp
+		FROM (
+			SELECT id, host, name, status, detail, timestamp,
+				LAG(status) OVER (PARTITION BY name ORDER BY timestamp, id) AS previous
+			FROM `+TblServiceStatus+`
+			WHERE timestamp >= $1 AND timestamp <= $2
+		) s
+		WHERE previous IS NULL OR previous <> status
+		ORDER BY timestamp, id
+		LIMIT $3;`,
+		toLocal(from), toLocal(to), limit)
+	if err != nil {
+		slog.Error("Failed to query status transitions", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var statuses []data.ServiceStatus
+	for rows.Next() {
+		var s data.ServiceStatus
+		if err := rows.Scan(&s.ID, &s.Host, &s.Name, &s.Status, &s.Detail, &s.Timestamp); err != nil {
+			slog.Error("Failed to scan service status", "error", err)
+			return nil, err
+		}
+		s.Timestamp = asLocal(s.Timestamp)
+		statuses = append(statuses, s)
+	}
+	return statuses, rows.Err()
+}
+
 func (m *serviceStatusRepo) CreateTableIfNotExists(ctx context.Context) {
 	if _, err := m.db.ExecContext(ctx, fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
@@ -85,8 +251,11 @@ func (m *serviceStatusRepo) CreateTableIfNotExists(ctx context.Context) {
 			status VARCHAR(50) NOT NULL,
 			detail TEXT
 		);
+		-- host was added with agents, rows from before belong to ''.
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT '';
 		CREATE INDEX IF NOT EXISTS idx_service_status_timestamp_desc ON %s (timestamp DESC);
 		CREATE INDEX IF NOT EXISTS idx_name ON %s (name);
+		CREATE INDEX IF NOT EXISTS idx_service_status_name_timestamp ON %s (name, timestamp DESC, id DESC);
 		COMMENT ON TABLE %s IS 'Stores services health status on homelab';
 		GRANT ALL ON %s TO minator;
 		GRANT USAGE, SELECT ON SEQUENCE service_status_id_seq TO minator;`,
@@ -94,6 +263,8 @@ func (m *serviceStatusRepo) CreateTableIfNotExists(ctx context.Context) {
 		TblServiceStatus,
 		TblServiceStatus,
 		TblServiceStatus,
+		TblServiceStatus,
+		TblServiceStatus,
 		TblServiceStatus)); err != nil {
 		slog.Error("Failed to create table", "tableName", TblServiceStatus, "error", err)
 	}
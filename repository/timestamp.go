@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Timestamps are stored as TIMESTAMP (without time zone) holding the local
+// wall clock, and postgres silently drops any offset we send along. Query
+// parameters therefore have to be converted to local time first, and values
+// read back have to be re-labelled as local since lib/pq reports them as UTC.
+
+func toLocal(t time.Time) time.Time {
+	return t.In(time.Local)
+}
+
+func asLocal(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	local := asLocal(t.Time)
+	return &local
+}
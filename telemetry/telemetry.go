@@ -0,0 +1,120 @@
+// Package telemetry keeps Minator's internal counters and gauges, exposed
+// in the Prometheus text format by the api package.
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vec is a set of values of one metric, keyed by a single label. It is
+// used both as a counter (Inc, Add) and as a gauge (Set, Dec).
+type Vec struct {
+	Name  string
+	Help  string
+	Type  string // "counter" or "gauge"
+	Label string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newVec(name, help, typ, label string) *Vec {
+	return &Vec{Name: name, Help: help, Type: typ, Label: label, values: map[string]float64{}}
+}
+
+func (v *Vec) Add(label string, delta float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[label] += delta
+}
+
+func (v *Vec) Inc(label string) { v.Add(label, 1) }
+func (v *Vec) Dec(label string) { v.Add(label, -1) }
+
+func (v *Vec) Set(label string, value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[label] = value
+}
+
+// Write writes v in the Prometheus text format.
+func (v *Vec) Write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	WriteHeader(w, v.Name, v.Help, v.Type)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		WriteSample(w, v.Name, map[string]string{v.Label: k}, v.values[k])
+	}
+}
+
+var (
+	ChecksRun      = newVec("minator_checks_run_total", "Checks run by the monitor.", "counter", "name")
+	CheckDuration  = newVec("minator_check_duration_seconds", "Duration of the last run of a check.", "gauge", "name")
+	CheckLastRun   = newVec("minator_check_last_run_timestamp_seconds", "When a check last ran, as a Unix timestamp.", "gauge", "name")
+	DBInsertErrors = newVec("minator_db_insert_errors_total", "Failed database inserts.", "counter", "table")
+	StreamClients  = newVec("minator_stream_clients", "Connected SSE and WebSocket clients.", "gauge", "stream")
+	ExportedPoints = newVec("minator_exported_points_total", "Points sent to or dropped by the OTLP exporter.", "counter", "result")
+)
+
+// All lists the metrics above, in exposition order.
+var All = []*Vec{ChecksRun, CheckDuration, CheckLastRun, DBInsertErrors, StreamClients, ExportedPoints}
+
+// ObserveCheck records a run of the check name that started at start.
+func ObserveCheck(name string, start time.Time, duration time.Duration) {
+	ChecksRun.Inc(name)
+	CheckDuration.Set(name, duration.Seconds())
+	CheckLastRun.Set(name, float64(start.UnixMilli())/1000)
+}
+
+// WriteHeader writes the HELP and TYPE lines of a metric.
+func WriteHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// WriteSample writes a single sample line, labels sorted by name.
+func WriteSample(w io.Writer, name string, labels map[string]string, value float64) {
+	fmt.Fprint(w, name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + `="` + escapeLabel(labels[k]) + `"`
+		}
+		fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(w, " %s\n", formatValue(value))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}